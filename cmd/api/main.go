@@ -1,15 +1,24 @@
 package main
 
 import (
+	"WB2/internal/auth"
 	"WB2/internal/cache"
 	"WB2/internal/config"
+	"WB2/internal/encryption"
+	"WB2/internal/health"
 	"WB2/internal/kafka"
 	"WB2/internal/lib/logger"
+	"WB2/internal/lifecycle"
+	"WB2/internal/metrics"
+	"WB2/internal/ratelimit"
 	"WB2/internal/server"
+	"WB2/internal/service"
 	storage "WB2/internal/storage/postgres"
+	"WB2/internal/tracing"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -25,74 +34,209 @@ func main() {
 	log.Info("WB", slog.String("env", cfg.Env))
 	log.Debug("debug message are enabled")
 
-	// Инициализируем хранилище (PostgreSQL) и выполняем миграции
-	db, err := storage.NewStorage(cfg.Database.DB_CONNECTION_STRING)
+	// Трассировка настраивается до хранилища и сервера, чтобы их спаны попадали в провайдер
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Error("Failed to init storage", logger.Err(err))
+		log.Error("Failed to init tracing", logger.Err(err))
 		os.Exit(1)
 	}
 
-	// Инициализируем кэш с TTL и прогреваем из БД
-	orderCache := cache.NewOrderCache(cfg.Cache.TTL)
-	if orders, err := db.GetAllOrders(); err == nil {
-		orderCache.Load(orders)
-		log.Info("cache warmed", slog.Int("orders", len(orders)))
+	// Ключи шифрования персональных данных нужны до первого обращения к БД
+	if cfg.Encryption.KeyFile != "" {
+		keyring, err := encryption.LoadKeyfile(cfg.Encryption.KeyFile)
+		if err != nil {
+			log.Error("Failed to load encryption keys", logger.Err(err))
+			os.Exit(1)
+		}
+		encryption.SetKeyring(keyring)
+		log.Info("encryption at rest enabled", slog.String("active_key_id", keyring.ActiveKeyID()))
 	} else {
-		log.Warn("failed to warm cache", logger.Err(err))
+		log.Warn("encryption at rest is disabled: personal data is stored in plaintext")
 	}
 
-	// Запускаем фоновую очистку кэша
-	cleanerCtx, cleanerCancel := context.WithCancel(context.Background())
-	defer cleanerCancel()
-	orderCache.StartCleaner(cleanerCtx)
+	// Инициализируем хранилище (PostgreSQL или встроенная SQLite, см. storage.driver) и выполняем миграции
+	db, err := storage.Open(cfg)
+	if err != nil {
+		log.Error("Failed to init storage", logger.Err(err))
+		os.Exit(1)
+	}
 
-	srv := server.NewServer(cfg, orderCache)
+	if err := metrics.RegisterGORM(db.Db, db.Driver); err != nil {
+		log.Error("Failed to register DB metrics", logger.Err(err))
+		os.Exit(1)
+	}
+	if err := tracing.InstrumentGORM(db.Db); err != nil {
+		log.Error("Failed to instrument DB tracing", logger.Err(err))
+		os.Exit(1)
+	}
+
+	// Компоненты запускаются в порядке добавления и останавливаются в обратном:
+	// HTTP -> Kafka consumer -> фоновые задачи -> БД -> трассировка
+	lc := lifecycle.NewManager(log)
+	lc.Add(lifecycle.Component{
+		Name: "tracing",
+		// Дописываем буферизованные спаны последними: к этому моменту их больше не появится
+		Stop: shutdownTracing,
+	})
+	lc.Add(lifecycle.Component{
+		Name: "database",
+		Stop: func(context.Context) error { return db.Close() },
+	})
+
+	// Инициализируем кэш с TTL и прогреваем из БД
+	orderCache := cache.NewOrderCache(cfg.Cache.TTL)
+	metrics.RegisterCache(orderCache)
+
+	// Операции с заказами общие для HTTP API и Kafka consumer
+	orderService := service.NewOrderService(db, orderCache)
+
+	// Проверки готовности для /readyz; consumer добавляется ниже, если настроен
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.Register("database", func(ctx context.Context) (map[string]any, error) {
+		stats, err := db.Ping(ctx)
+		return map[string]any{"open_connections": stats.OpenConnections, "in_use": stats.InUse}, err
+	})
+	checker.Register("cache", func(context.Context) (map[string]any, error) {
+		details := map[string]any{"warm": orderCache.Warm(), "size": orderCache.Len()}
+		if !orderCache.Warm() {
+			return details, errors.New("cache warm-up is not finished")
+		}
+		return details, nil
+	})
 
-	log.Info("Starting HTTP server", slog.String("port", cfg.HTTPServer.Port))
+	// Аутентификация HTTP API: API-ключи и/или JWT из конфигурации
+	var authenticator auth.Authenticator
+	if cfg.Auth.Enabled {
+		authenticator, err = auth.NewAuthenticator(cfg.Auth)
+		if err != nil {
+			log.Error("Failed to init authentication", logger.Err(err))
+			os.Exit(1)
+		}
+	} else {
+		// Без аутентификации любой клиент получает роль anonymous_role; в проде так запускаться нельзя
+		if cfg.Env == "prod" {
+			log.Error("HTTP API authentication must be enabled in prod: set auth.enabled and configure api keys or jwt")
+			os.Exit(1)
+		}
+		if _, err := auth.ParseRole(cfg.Auth.AnonymousRole); err != nil {
+			log.Error("Invalid auth.anonymous_role", logger.Err(err))
+			os.Exit(1)
+		}
+		log.Warn("HTTP API AUTHENTICATION IS DISABLED: every request is served as an anonymous client",
+			slog.String("role", cfg.Auth.AnonymousRole))
+	}
 
-	// Запускаем HTTP-сервер
-	go func() {
-		if err := srv.Start(log, db); err != nil && err != http.ErrServerClosed {
-			log.Error("Failed to start server", logger.Err(err))
+	// Rate limiting: корзины в памяти реплики либо общие в PostgreSQL
+	var limiter ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter, err = ratelimit.New(log, cfg.RateLimit, db)
+		if err != nil {
+			log.Error("Failed to init rate limiter", logger.Err(err))
 			os.Exit(1)
 		}
-	}()
-
-	// Запускаем Kafka consumer
-	var consumerCancel context.CancelFunc
-	if len(cfg.Kafka.Brokers) > 0 && cfg.Kafka.Topic != "" && cfg.Kafka.GroupID != "" {
-		ctx, cancel := context.WithCancel(context.Background())
-		consumerCancel = cancel
-		cons, err := kafka.NewConsumer(log, db, orderCache, cfg.Kafka.Brokers, cfg.Kafka.GroupID, cfg.Kafka.Topic, cfg.Kafka.Version)
+	}
+
+	// Фоновые задачи: прогрев и очистка кэша, очистка ключей идемпотентности и корзин rate limiting
+	var backgroundCancel context.CancelFunc
+	lc.Add(lifecycle.Component{
+		Name: "background",
+		Start: func(context.Context) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			backgroundCancel = cancel
+			// Прогрев кэша повторяется, пока не удастся: до его завершения сервис не готов (/readyz)
+			go warmCache(ctx, log, db, orderCache)
+			orderCache.StartCleaner(ctx)
+			db.StartIdempotencyCleaner(ctx, cfg.Idempotency.CleanupInterval)
+			if cleaner, ok := limiter.(ratelimit.Cleaner); ok {
+				cleaner.StartCleaner(ctx, time.Minute)
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			backgroundCancel()
+			return nil
+		},
+	})
+
+	// Kafka consumer
+	if len(cfg.Kafka.Brokers) > 0 && len(cfg.Kafka.TopicList()) > 0 && cfg.Kafka.GroupID != "" {
+		// Пока БД недоступна, consumer стоит на паузе и проверяет её тем же Ping, что и /readyz
+		cons, err := kafka.NewConsumer(log, orderService, cfg.Kafka, func(ctx context.Context) error {
+			_, err := db.Ping(ctx)
+			return err
+		})
 		if err != nil {
 			log.Error("Failed to init kafka consumer", logger.Err(err))
+			checker.Register("kafka_consumer", func(context.Context) (map[string]any, error) {
+				return nil, fmt.Errorf("consumer init failed: %w", err)
+			})
 		} else {
-			go func() {
-				if err := cons.Run(ctx); err != nil && err != context.Canceled {
-					log.Error("Kafka consumer stopped", logger.Err(err))
-				}
-			}()
+			checker.Register("kafka_consumer", cons.HealthCheck(cfg.Health.ConsumerStallTimeout))
+			lc.Add(lifecycle.Component{
+				Name:  "kafka_consumer",
+				Start: func(context.Context) error { cons.Start(); return nil },
+				Stop:  cons.Stop,
+			})
 		}
 	}
 
+	// HTTP-сервер стартует последним и останавливается первым: новые запросы не принимаются,
+	// пока остальные компоненты ещё работают и дообслуживают начатые
+	srv := server.NewServer(cfg, orderCache, orderService, authenticator, limiter, checker)
+	lc.Add(lifecycle.Component{
+		Name: "http",
+		Start: func(context.Context) error {
+			log.Info("Starting HTTP server", slog.String("port", cfg.HTTPServer.Port))
+			return srv.Start(log, db, func(err error) { lc.Fail("http", err) })
+		},
+		Stop: srv.Stop,
+	})
+
+	if err := lc.Start(context.Background()); err != nil {
+		log.Error("Failed to start service", logger.Err(err))
+		os.Exit(1)
+	}
 	log.Info("Server started successfully", slog.String("port", cfg.HTTPServer.Port))
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	failErr := lc.Wait(sigCtx)
+	if failErr != nil {
+		log.Error("Component failed, shutting down", logger.Err(failErr))
+	}
 	log.Info("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	if consumerCancel != nil {
-		consumerCancel()
+	begin := time.Now()
+	results := lc.Stop(ctx)
+	if err := lifecycle.Err(results); err != nil {
+		log.Error("Server stopped with errors", logger.Err(err), slog.Duration("duration", time.Since(begin)))
+		os.Exit(1)
 	}
-
-	if err := srv.Stop(ctx); err != nil {
-		log.Error("Failed to stop server", logger.Err(err))
+	log.Info("Server gracefully stopped", slog.Duration("duration", time.Since(begin)))
+	if failErr != nil {
+		os.Exit(1)
 	}
+}
 
-	log.Info("Server gracefully stopped")
-
+// warmCache загружает заказы из БД в кэш, повторяя попытки до успеха или отмены ctx
+func warmCache(ctx context.Context, log *slog.Logger, db *storage.Storage, c *cache.OrderCache) {
+	const retryInterval = 5 * time.Second
+	for {
+		orders, err := db.GetAllOrders()
+		if err == nil {
+			c.Load(orders)
+			c.MarkWarm()
+			log.Info("cache warmed", slog.Int("orders", len(orders)))
+			return
+		}
+		log.Warn("failed to warm cache, retrying", logger.Err(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
 }
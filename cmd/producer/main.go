@@ -4,26 +4,27 @@ import (
 	"context"
 	"log"
 	"os"
-	"strings"
 	"time"
 
+	"WB2/internal/config"
 	"WB2/internal/dto/response"
 	"WB2/internal/kafka"
+	"WB2/internal/tracing"
 
 	"github.com/google/uuid"
 )
 
 func main() {
 
-	brokersEnv := os.Getenv("KAFKA_BROKERS")
-	if brokersEnv == "" {
-		brokersEnv = "localhost:9092"
+	// Брокеры, TLS и SASL - из окружения (KAFKA_BROKERS, KAFKA_TLS_*, KAFKA_SASL_*)
+	kc, err := config.NewKafkaFromEnv()
+	if err != nil {
+		log.Fatalf("failed to read kafka settings: %v", err)
 	}
-	topic := os.Getenv("KAFKA_TOPIC")
-	if topic == "" {
-		topic = "orders"
+	kc.Topic = os.Getenv("KAFKA_TOPIC")
+	if kc.Topic == "" {
+		kc.Topic = "orders"
 	}
-	brokers := strings.Split(brokersEnv, ",")
 
 	payload := response.OrderResponse{
 		OrderUID:        uuid.NewString(),
@@ -73,8 +74,28 @@ func main() {
 		},
 	}
 
-	if err := kafka.ProduceTestMessage(context.Background(), brokers, topic, payload); err != nil {
+	// Трассировка включается заданием TRACING_EXPORTER (otlp, stdout или file): контекст трассы уходит в заголовках сообщения
+	tracingCfg := config.Tracing{
+		Enabled:     os.Getenv("TRACING_EXPORTER") != "",
+		ServiceName: "wb-producer",
+		Exporter:    os.Getenv("TRACING_EXPORTER"),
+		Endpoint:    os.Getenv("TRACING_ENDPOINT"),
+		Insecure:    true,
+		File:        "producer-traces.json",
+		SampleRatio: 1,
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingCfg)
+	if err != nil {
+		log.Fatalf("failed to init tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("failed to flush traces: %v", err)
+		}
+	}()
+
+	if err := kafka.ProduceTestMessage(context.Background(), kc, payload.OrderUID, payload); err != nil {
 		log.Fatalf("failed to produce message: %v", err)
 	}
-	log.Printf("produced test order to topic %s", topic)
+	log.Printf("produced test order to topic %s", kc.Topic)
 }
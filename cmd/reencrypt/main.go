@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"WB2/internal/config"
+	"WB2/internal/encryption"
+	storage "WB2/internal/storage/postgres"
+)
+
+// reencrypt переписывает зашифрованные колонки под активный ключ из keyfile.
+// Порядок ротации: добавить новый ключ в keyfile и сделать его active_key_id, перезапустить API,
+// запустить reencrypt, после чего старый ключ можно удалить из keyfile
+func main() {
+	batchSize := flag.Int("batch", 500, "rows per transaction")
+	flag.Parse()
+
+	cfg := config.NewConfig()
+	if cfg.Encryption.KeyFile == "" {
+		log.Fatal("encryption.key_file (or ENCRYPTION_KEY_FILE) is not set")
+	}
+	keyring, err := encryption.LoadKeyfile(cfg.Encryption.KeyFile)
+	if err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+	encryption.SetKeyring(keyring)
+
+	db, err := storage.Open(cfg)
+	if err != nil {
+		log.Fatalf("failed to init storage: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	stats, err := db.Reencrypt(ctx, *batchSize)
+	for table, n := range stats {
+		log.Printf("%s: %d rows re-encrypted", table, n)
+	}
+	if err != nil {
+		log.Fatalf("re-encryption failed: %v", err)
+	}
+	log.Printf("all rows are encrypted with key %s", keyring.ActiveKeyID())
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"WB2/internal/config"
+	"WB2/internal/kafka"
+)
+
+// resetoffsets сдвигает смещения consumer group заказов, чтобы перечитать топик или пропустить его часть.
+// Без -execute только печатает план. Consumer'ы группы на время сброса нужно остановить
+func main() {
+	to := flag.String("to", "", "earliest, latest, timestamp (with -time) or offset (with -offsets)")
+	at := flag.String("time", "", "RFC3339 time for -to timestamp, e.g. 2024-05-01T00:00:00Z")
+	offsets := flag.String("offsets", "", "partition=offset pairs for -to offset, e.g. 0=120,1=340")
+	partitions := flag.String("partitions", "", "comma-separated partitions to reset (default: all)")
+	group := flag.String("group", "", "consumer group (default: kafka.group_id)")
+	topic := flag.String("topic", "", "topic (default: kafka.topic or the only entry of kafka.topics)")
+	execute := flag.Bool("execute", false, "commit the new offsets instead of printing the plan")
+	flag.Parse()
+
+	target, err := parseTarget(*to, *at, *offsets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	parts, err := parsePartitions(*partitions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := config.NewConfig()
+	if *group != "" {
+		cfg.Kafka.GroupID = *group
+	}
+	switch topics := cfg.Kafka.TopicList(); {
+	case *topic != "":
+		cfg.Kafka.Topic = *topic
+	case len(topics) > 1:
+		log.Fatalf("group reads several topics %v: choose one with -topic", topics)
+	case len(topics) == 1:
+		cfg.Kafka.Topic = topics[0]
+	}
+	if len(cfg.Kafka.Brokers) == 0 || cfg.Kafka.GroupID == "" || cfg.Kafka.Topic == "" {
+		log.Fatal("kafka brokers, group_id and topic must be set")
+	}
+
+	resetter, err := kafka.NewOffsetResetter(cfg.Kafka)
+	if err != nil {
+		log.Fatalf("failed to connect to kafka: %v", err)
+	}
+	defer resetter.Close()
+
+	plan, err := resetter.Plan(target, parts)
+	if err != nil {
+		log.Fatalf("failed to plan offsets: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tCURRENT\tNEW")
+	for _, po := range plan {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", po.Partition, formatOffset(po.Current), formatOffset(po.Target))
+	}
+	w.Flush()
+
+	if !*execute {
+		log.Printf("dry run for group %s, topic %s: pass -execute to commit", cfg.Kafka.GroupID, cfg.Kafka.Topic)
+		return
+	}
+	if err := resetter.Apply(plan); err != nil {
+		log.Fatalf("failed to reset offsets: %v", err)
+	}
+	log.Printf("offsets of group %s reset", cfg.Kafka.GroupID)
+}
+
+func parseTarget(to, at, offsets string) (kafka.ResetTarget, error) {
+	target := kafka.ResetTarget{Kind: to}
+	switch to {
+	case kafka.ResetEarliest, kafka.ResetLatest:
+	case kafka.ResetTimestamp:
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return target, fmt.Errorf("-to timestamp needs -time in RFC3339: %w", err)
+		}
+		target.Time = t
+	case kafka.ResetOffset:
+		target.Offsets = make(map[int32]int64)
+		for _, pair := range strings.Split(offsets, ",") {
+			p, o, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				return target, fmt.Errorf("-offsets: want partition=offset, got %q", pair)
+			}
+			partition, err := strconv.ParseInt(p, 10, 32)
+			if err != nil {
+				return target, fmt.Errorf("-offsets: bad partition %q", p)
+			}
+			offset, err := strconv.ParseInt(o, 10, 64)
+			if err != nil || offset < 0 {
+				return target, fmt.Errorf("-offsets: bad offset %q", o)
+			}
+			target.Offsets[int32(partition)] = offset
+		}
+	default:
+		return target, fmt.Errorf("-to must be earliest, latest, timestamp or offset")
+	}
+	return target, nil
+}
+
+func parsePartitions(s string) ([]int32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var parts []int32
+	for _, p := range strings.Split(s, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(p), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("-partitions: bad partition %q", p)
+		}
+		parts = append(parts, int32(n))
+	}
+	return parts, nil
+}
+
+func formatOffset(offset int64) string {
+	if offset < 0 {
+		return "-"
+	}
+	return strconv.FormatInt(offset, 10)
+}
@@ -0,0 +1,137 @@
+package apperr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/glebarez/go-sqlite"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Категории доменных ошибок; проверяются через errors.Is
+var (
+	ErrBadRequest  = errors.New("bad request")
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrValidation  = errors.New("validation failed")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// FieldError - ошибка значения одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error - доменная ошибка с машиночитаемым кодом и сообщением, которое можно показать клиенту.
+// Причина (Err) в ответ не попадает и нужна только для логов
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		parts := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			parts[i] = f.Field + ": " + f.Message
+		}
+		msg += " (" + strings.Join(parts, "; ") + ")"
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap позволяет проверять и категорию, и причину ошибки
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// BadRequest - запрос не удалось разобрать (синтаксис JSON, параметры)
+func BadRequest(code, message string) *Error {
+	return &Error{Kind: ErrBadRequest, Code: code, Message: message}
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+// Validation - запрос разобран, но значения полей недопустимы
+func Validation(message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: message, Fields: fields}
+}
+
+// Unavailable - зависимость (БД) временно недоступна, запрос можно повторить
+func Unavailable(message string, cause error) *Error {
+	return &Error{Kind: ErrUnavailable, Code: "storage_unavailable", Message: message, Err: cause}
+}
+
+// WithCause добавляет причину ошибки для логов
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// FromStorage переводит ошибку хранилища в доменную: отсутствие записи - ErrNotFound,
+// нарушение уникальности - ErrConflict, проблемы соединения и таймауты - ErrUnavailable.
+// Прочие ошибки возвращаются как есть и в ответе становятся 500 без подробностей.
+// notFound и conflict задают коды и сообщения для клиента; nil - категорию не переводить
+func FromStorage(err error, notFound, conflict *Error) error {
+	var appErr *Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &appErr):
+		return err
+	case notFound != nil && errors.Is(err, gorm.ErrRecordNotFound):
+		return notFound.WithCause(err)
+	case conflict != nil && errors.Is(err, gorm.ErrDuplicatedKey):
+		return conflict.WithCause(err)
+	case IsUnavailable(err):
+		return Unavailable("storage is temporarily unavailable", err)
+	}
+	return err
+}
+
+// IsUnavailable сообщает, вызвана ли ошибка недоступностью БД, а не самим запросом
+func IsUnavailable(err error) bool {
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 - ошибки соединения, 53 - нехватка ресурсов, 57P - сервер останавливается
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		// SQLITE_BUSY и SQLITE_LOCKED ("database is locked"): файл занят другой записью дольше busy_timeout.
+		// Младший байт - основной код, старшие - расширенный
+		code := liteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.As(err, &connErr) ||
+		errors.As(err, &netErr)
+}
@@ -0,0 +1,57 @@
+package apperr
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/glebarez/go-sqlite"
+	"gorm.io/gorm"
+)
+
+// Запись в файл SQLite, занятый другой транзакцией дольше busy_timeout, - недоступность хранилища (503
+// и размыкание автомата consumer), а не ошибка запроса
+func TestIsUnavailableSQLiteBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "busy.db")
+	holder, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = holder.Close() })
+	if _, err := holder.Exec("CREATE TABLE orders (uid TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lock.Rollback() })
+	if _, err := lock.Exec("INSERT INTO orders VALUES ('held')"); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = writer.Close() })
+	_, err = writer.Exec("INSERT INTO orders VALUES ('blocked')")
+	if err == nil {
+		t.Fatal("write to a locked database succeeded")
+	}
+	if !IsUnavailable(err) {
+		t.Fatalf("IsUnavailable(%v) = false", err)
+	}
+	if mapped := FromStorage(err, nil, nil); !errors.Is(mapped, ErrUnavailable) {
+		t.Fatalf("FromStorage(%v) = %v, want ErrUnavailable", err, mapped)
+	}
+}
+
+func TestIsUnavailableIgnoresRequestErrors(t *testing.T) {
+	for _, err := range []error{gorm.ErrRecordNotFound, gorm.ErrDuplicatedKey, errors.New("constraint failed")} {
+		if IsUnavailable(err) {
+			t.Errorf("IsUnavailable(%v) = true", err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package audit
+
+import "context"
+
+// AnonymousActor - автор изменения, если он не определён
+const AnonymousActor = "anonymous"
+
+type actorKey struct{}
+
+// WithActor возвращает контекст с автором изменений для журнала
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает автора изменений из контекста или AnonymousActor
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// KafkaActor - автор изменений, пришедших из топика Kafka
+func KafkaActor(topic string) string {
+	return "kafka:" + topic
+}
+
+// BaselineActor - автор начальных снимков заказов, созданных до появления журнала изменений
+const BaselineActor = "system:baseline"
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"WB2/internal/dto/response"
+	"WB2/internal/models"
+	"WB2/internal/redact"
+)
+
+// Snapshot - JSON-представление одной сущности заказа в журнале
+type Snapshot map[string]any
+
+// Change - изменение одного поля
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type entityKey struct {
+	entity models.AuditEntity
+	id     uint
+}
+
+// entityOrder задаёт порядок записей журнала внутри одной операции
+var entityOrder = map[models.AuditEntity]int{
+	models.AuditEntityOrder:    0,
+	models.AuditEntityDelivery: 1,
+	models.AuditEntityPayment:  2,
+	models.AuditEntityItem:     3,
+}
+
+// orderOnlyFields - поля OrderResponse, не относящиеся к самой сущности заказа
+var orderOnlyFields = []string{"delivery", "payment", "items", "created_at", "updated_at"}
+
+// snapshots разбивает агрегат заказа на снимки отдельных сущностей
+func snapshots(o *models.Order) (map[entityKey]Snapshot, error) {
+	result := make(map[entityKey]Snapshot)
+	if o == nil {
+		return result, nil
+	}
+	// журнал хранит данные без маскирования, оно применяется при выдаче истории
+	resp := response.ToOrderResponse(o, redact.None)
+
+	orderSnap, err := toSnapshot(resp)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range orderOnlyFields {
+		delete(orderSnap, f)
+	}
+	result[entityKey{models.AuditEntityOrder, o.ID}] = orderSnap
+
+	if o.Delivery.ID != 0 {
+		if result[entityKey{models.AuditEntityDelivery, o.Delivery.ID}], err = toSnapshot(resp.Delivery); err != nil {
+			return nil, err
+		}
+	}
+	if o.Payment.ID != 0 {
+		if result[entityKey{models.AuditEntityPayment, o.Payment.ID}], err = toSnapshot(resp.Payment); err != nil {
+			return nil, err
+		}
+	}
+	for _, it := range resp.Items {
+		if it.ID == 0 {
+			continue
+		}
+		if result[entityKey{models.AuditEntityItem, it.ID}], err = toSnapshot(it); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Changes сравнивает агрегат до и после операции и возвращает записи журнала по изменившимся сущностям.
+// before == nil означает создание заказа, after == nil - удаление
+func Changes(actor string, before, after *models.Order) ([]models.OrderAudit, error) {
+	beforeSnaps, err := snapshots(before)
+	if err != nil {
+		return nil, err
+	}
+	afterSnaps, err := snapshots(after)
+	if err != nil {
+		return nil, err
+	}
+	orderUID := ""
+	if after != nil {
+		orderUID = after.OrderUID
+	} else if before != nil {
+		orderUID = before.OrderUID
+	}
+
+	keys := make([]entityKey, 0, len(beforeSnaps)+len(afterSnaps))
+	for k := range beforeSnaps {
+		keys = append(keys, k)
+	}
+	for k := range afterSnaps {
+		if _, ok := beforeSnaps[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].entity != keys[j].entity {
+			return entityOrder[keys[i].entity] < entityOrder[keys[j].entity]
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	var records []models.OrderAudit
+	for _, k := range keys {
+		b, hadBefore := beforeSnaps[k]
+		a, hasAfter := afterSnaps[k]
+		action := models.AuditActionUpdate
+		switch {
+		case !hadBefore:
+			action = models.AuditActionCreate
+		case !hasAfter:
+			action = models.AuditActionDelete
+		}
+		diff := Diff(b, a)
+		if action == models.AuditActionUpdate && len(diff) == 0 {
+			continue
+		}
+		rec := models.OrderAudit{
+			OrderUID: orderUID,
+			Entity:   k.entity,
+			EntityID: k.id,
+			Action:   action,
+			Actor:    actor,
+		}
+		if rec.Before, err = marshalSnapshot(b); err != nil {
+			return nil, err
+		}
+		if rec.After, err = marshalSnapshot(a); err != nil {
+			return nil, err
+		}
+		d, err := json.Marshal(diff)
+		if err != nil {
+			return nil, err
+		}
+		rec.Diff = string(d)
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Diff возвращает поля, значения которых различаются в двух снимках (nil-снимок считается пустым)
+func Diff(before, after Snapshot) map[string]Change {
+	diff := make(map[string]Change)
+	for k, bv := range before {
+		av, ok := after[k]
+		if !ok || !reflect.DeepEqual(bv, av) {
+			diff[k] = Change{From: bv, To: av}
+		}
+	}
+	for k, av := range after {
+		if _, ok := before[k]; !ok {
+			diff[k] = Change{From: nil, To: av}
+		}
+	}
+	return diff
+}
+
+func toSnapshot(v any) (Snapshot, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func marshalSnapshot(s Snapshot) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"WB2/internal/dto/response"
+	"WB2/internal/models"
+)
+
+// PathChange - изменение значения по пути в агрегате заказа (например, "delivery.city" или "items[3].price")
+type PathChange struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// Reconstruct восстанавливает агрегат заказа, последовательно применяя записи журнала (в порядке их id).
+// Возвращает nil, если по этим записям заказ не существует (ещё не создан или уже удалён)
+func Reconstruct(records []models.OrderAudit) (*response.OrderResponse, error) {
+	state := make(map[entityKey]string)
+	for _, r := range records {
+		k := entityKey{r.Entity, r.EntityID}
+		if r.Action == models.AuditActionDelete {
+			delete(state, k)
+			continue
+		}
+		state[k] = r.After
+	}
+
+	var order *response.OrderResponse
+	var items []response.ItemResponse
+	for k, snap := range state {
+		var err error
+		switch k.entity {
+		case models.AuditEntityOrder:
+			order = &response.OrderResponse{}
+			err = json.Unmarshal([]byte(snap), order)
+		case models.AuditEntityItem:
+			var it response.ItemResponse
+			if err = json.Unmarshal([]byte(snap), &it); err == nil {
+				items = append(items, it)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("audit: decode %s %d: %w", k.entity, k.id, err)
+		}
+	}
+	if order == nil {
+		return nil, nil
+	}
+	for k, snap := range state {
+		var err error
+		switch k.entity {
+		case models.AuditEntityDelivery:
+			err = json.Unmarshal([]byte(snap), &order.Delivery)
+		case models.AuditEntityPayment:
+			err = json.Unmarshal([]byte(snap), &order.Payment)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("audit: decode %s %d: %w", k.entity, k.id, err)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	order.Items = items
+	if order.Items == nil {
+		order.Items = []response.ItemResponse{}
+	}
+	// Время создания и последнего изменения восстанавливаем по самому журналу
+	order.CreatedAt = records[0].CreatedAt
+	order.UpdatedAt = records[len(records)-1].CreatedAt
+	return order, nil
+}
+
+// DiffOrders сравнивает два состояния агрегата заказа и возвращает изменения по путям, отсортированные по пути.
+// nil означает, что заказа в этот момент не было
+func DiffOrders(from, to *response.OrderResponse) ([]PathChange, error) {
+	a, err := flattenOrder(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := flattenOrder(to)
+	if err != nil {
+		return nil, err
+	}
+	diff := Diff(a, b)
+	changes := make([]PathChange, 0, len(diff))
+	for path, ch := range diff {
+		changes = append(changes, PathChange{Path: path, From: ch.From, To: ch.To})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// flattenOrder разворачивает агрегат в плоский снимок; товары адресуются по id, а не по позиции в списке.
+// Служебные метки created_at/updated_at в сравнение не входят
+func flattenOrder(o *response.OrderResponse) (Snapshot, error) {
+	flat := make(Snapshot)
+	if o == nil {
+		return flat, nil
+	}
+	snap, err := toSnapshot(o)
+	if err != nil {
+		return nil, err
+	}
+	delete(snap, "created_at")
+	delete(snap, "updated_at")
+	for k, v := range snap {
+		switch val := v.(type) {
+		case map[string]any:
+			for field, fv := range val {
+				flat[k+"."+field] = fv
+			}
+		case []any:
+			for _, el := range val {
+				item, ok := el.(map[string]any)
+				if !ok {
+					continue
+				}
+				prefix := fmt.Sprintf("%s[%v]", k, item["id"])
+				for field, fv := range item {
+					flat[prefix+"."+field] = fv
+				}
+			}
+		default:
+			flat[k] = v
+		}
+	}
+	return flat, nil
+}
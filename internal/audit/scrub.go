@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"WB2/internal/models"
+)
+
+// Scrub заменяет значения полей values в снимках и diff записи журнала.
+// Используется при обезличивании: персональные данные не должны оставаться и в истории изменений
+func Scrub(rec *models.OrderAudit, values map[string]any) error {
+	var err error
+	if rec.Before, err = scrubSnapshot(rec.Before, values); err != nil {
+		return err
+	}
+	if rec.After, err = scrubSnapshot(rec.After, values); err != nil {
+		return err
+	}
+	if rec.Diff == "" {
+		return nil
+	}
+	var diff map[string]Change
+	if err := json.Unmarshal([]byte(rec.Diff), &diff); err != nil {
+		return err
+	}
+	for field, v := range values {
+		if _, ok := diff[field]; ok {
+			diff[field] = Change{From: v, To: v}
+		}
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	rec.Diff = string(data)
+	return nil
+}
+
+func scrubSnapshot(raw string, values map[string]any) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	var snap Snapshot
+	if err := json.Unmarshal([]byte(raw), &snap); err != nil {
+		return "", err
+	}
+	for field, v := range values {
+		if _, ok := snap[field]; ok {
+			snap[field] = v
+		}
+	}
+	return marshalSnapshot(snap)
+}
+
+// ErasedDeliveryFields - значения полей снимка доставки после models.Delivery.Anonymize
+func ErasedDeliveryFields() map[string]any {
+	var d models.Delivery
+	d.Anonymize()
+	return map[string]any{
+		"name":    d.Name,
+		"phone":   d.Phone,
+		"email":   d.Email,
+		"address": d.Address,
+		"zip":     d.Zip,
+	}
+}
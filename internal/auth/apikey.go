@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"WB2/internal/config"
+)
+
+// HeaderAPIKey - заголовок со статическим API-ключом
+const HeaderAPIKey = "X-API-Key"
+
+type apiKeyEntry struct {
+	hash [sha256.Size]byte
+	name string
+	role Role
+}
+
+// APIKeyAuthenticator проверяет статические ключи из конфигурации.
+// Ключи хранятся в виде SHA-256 и сравниваются за постоянное время
+type APIKeyAuthenticator struct {
+	keys []apiKeyEntry
+}
+
+// LoadAPIKeys собирает API-ключи из конфига, файла api_keys_file и переменной AUTH_API_KEYS
+// (name:role:key через запятую; сам ключ может содержать двоеточия, но не запятые)
+func LoadAPIKeys(cfg config.Auth) ([]config.APIKey, error) {
+	keys := append([]config.APIKey(nil), cfg.APIKeys...)
+	if cfg.APIKeysFile != "" {
+		data, err := os.ReadFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("api_keys_file: %w", err)
+		}
+		var fromFile []config.APIKey
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return nil, fmt.Errorf("api_keys_file %s: %w", cfg.APIKeysFile, err)
+		}
+		keys = append(keys, fromFile...)
+	}
+	for i, entry := range strings.Split(cfg.APIKeysEnv, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("AUTH_API_KEYS[%d]: want name:role:key", i)
+		}
+		keys = append(keys, config.APIKey{Name: parts[0], Role: parts[1], Key: parts[2]})
+	}
+	return keys, nil
+}
+
+func NewAPIKeyAuthenticator(keys []config.APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{keys: make([]apiKeyEntry, 0, len(keys))}
+	for i, k := range keys {
+		if k.Key == "" || k.Name == "" {
+			return nil, fmt.Errorf("api_keys[%d]: name and key are required", i)
+		}
+		role, err := ParseRole(k.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api_keys[%d]: %w", i, err)
+		}
+		a.keys = append(a.keys, apiKeyEntry{hash: sha256.Sum256([]byte(k.Key)), name: k.Name, role: role})
+	}
+	return a, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	hash := sha256.Sum256([]byte(key))
+	var found *apiKeyEntry
+	// проверяем все ключи, чтобы время ответа не зависело от позиции совпадения
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: found.name, Role: found.role, Method: "apikey"}, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"WB2/internal/config"
+)
+
+func TestNewAuthenticatorLoadsKeysFromFileAndEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "api_keys.json")
+	if err := os.WriteFile(file, []byte(`[{"name": "ops", "key": "file-key", "role": "admin"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAuthenticator(config.Auth{Enabled: true, APIKeysFile: file, APIKeysEnv: "bot:writer:env:key, "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]Principal{
+		"file-key": {Subject: "ops", Role: RoleAdmin, Method: "apikey"},
+		"env:key":  {Subject: "bot", Role: RoleWriter, Method: "apikey"},
+	} {
+		r := httptest.NewRequest("GET", "/order", nil)
+		r.Header.Set(HeaderAPIKey, key)
+		p, err := a.Authenticate(r)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if *p != want {
+			t.Errorf("key %q: got %+v, want %+v", key, *p, want)
+		}
+	}
+}
+
+func TestNewAuthenticatorRequiresCredentials(t *testing.T) {
+	for name, cfg := range map[string]config.Auth{
+		"nothing configured": {Enabled: true},
+		"malformed env":      {Enabled: true, APIKeysEnv: "reader-without-key"},
+		"missing file":       {Enabled: true, APIKeysFile: filepath.Join(t.TempDir(), "absent.json")},
+	} {
+		if _, err := NewAuthenticator(cfg); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"WB2/internal/config"
+)
+
+var (
+	// ErrNoCredentials - в запросе нет учётных данных, которые понимает аутентификатор
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials - учётные данные переданы, но не прошли проверку
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator определяет клиента по HTTP-запросу
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain пробует аутентификаторы по очереди; первый, нашедший учётные данные, определяет результат
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// NewAuthenticator собирает цепочку аутентификаторов из конфигурации: API-ключи и JWT (HS256 и/или RS256 по JWKS).
+// Без ключей и JWT возвращает ошибку: включённая аутентификация без учётных данных закрыла бы весь API
+func NewAuthenticator(cfg config.Auth) (Authenticator, error) {
+	const op = "auth.NewAuthenticator"
+
+	keys, err := LoadAPIKeys(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var chain Chain
+	if len(keys) > 0 {
+		a, err := NewAPIKeyAuthenticator(keys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		chain = append(chain, a)
+	}
+	if cfg.JWT.HS256Secret != "" || cfg.JWT.JWKSFile != "" {
+		a, err := NewJWTAuthenticator(cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		chain = append(chain, a)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s: auth is enabled but no api keys (api_keys_file, AUTH_API_KEYS) or jwt are configured", op)
+	}
+	return chain, nil
+}
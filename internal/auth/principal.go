@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Role - роль клиента API; роли упорядочены: reader < writer < admin
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleWriter Role = "writer"
+	RoleAdmin  Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleReader: 1,
+	RoleWriter: 2,
+	RoleAdmin:  3,
+}
+
+// ParseRole проверяет, что строка - известная роль
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return r, nil
+}
+
+// Allows сообщает, что роль r не ниже требуемой
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// Principal - аутентифицированный клиент запроса
+type Principal struct {
+	Subject string
+	Role    Role
+	// Method - способ аутентификации: apikey, jwt или none (аутентификация выключена)
+	Method string
+}
+
+// Anonymous - клиент запроса при выключенной аутентификации
+func Anonymous(role Role) *Principal {
+	return &Principal{Subject: "anonymous", Role: role, Method: "none"}
+}
+
+// Actor - идентификатор клиента для журнала изменений и логов
+func (p *Principal) Actor() string {
+	return p.Method + ":" + p.Subject
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с клиентом запроса
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает клиента запроса из контекста
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
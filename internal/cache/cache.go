@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"WB2/internal/models"
@@ -18,6 +19,19 @@ type OrderCache struct {
 	mu    sync.RWMutex
 	byUID map[string]entry
 	ttl   time.Duration
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	// warm - кэш прогрет содержимым БД (см. MarkWarm)
+	warm atomic.Bool
+}
+
+// Stats - счётчики обращений к кэшу с момента запуска
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
 }
 
 func NewOrderCache(ttl time.Duration) *OrderCache {
@@ -45,16 +59,46 @@ func (c *OrderCache) Get(orderUID string) (*models.Order, bool) {
 	e, ok := c.byUID[orderUID]
 	c.mu.RUnlock()
 	if !ok {
+		c.misses.Add(1)
 		return nil, false
 	}
 	if time.Now().After(e.expiresAt) {
 		// lazy expiration
 		c.Delete(orderUID)
+		c.evictions.Add(1)
+		c.misses.Add(1)
 		return nil, false
 	}
+	c.hits.Add(1)
 	return e.order, true
 }
 
+// Len возвращает число записей в кэше, включая ещё не удалённые просроченные
+func (c *OrderCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.byUID)
+}
+
+// MarkWarm отмечает, что кэш прогрет содержимым БД
+func (c *OrderCache) MarkWarm() {
+	c.warm.Store(true)
+}
+
+// Warm сообщает, завершён ли прогрев кэша
+func (c *OrderCache) Warm() bool {
+	return c.warm.Load()
+}
+
+// Stats возвращает счётчики попаданий, промахов и вытеснений по TTL
+func (c *OrderCache) Stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
 func (c *OrderCache) GetAll() []*models.Order {
 	now := time.Now()
 	c.mu.RLock()
@@ -73,11 +117,13 @@ func (c *OrderCache) GetAll() []*models.Order {
 	return result
 }
 
+// Load наполняет кэш при прогреве. Уже закэшированные заказы не перезаписываются:
+// прогрев идёт параллельно с работой API, и они свежее прочитанных из БД
 func (c *OrderCache) Load(orders []models.Order) {
 	c.mu.Lock()
 	for i := range orders {
 		o := orders[i]
-		if o.OrderUID != "" {
+		if _, exists := c.byUID[o.OrderUID]; o.OrderUID != "" && !exists {
 			order := o // локальная копия
 			c.byUID[o.OrderUID] = entry{order: &order, expiresAt: time.Now().Add(c.ttl)}
 		}
@@ -118,6 +164,7 @@ func (c *OrderCache) cleanupExpired() {
 	for uid, e := range c.byUID {
 		if now.After(e.expiresAt) {
 			delete(c.byUID, uid)
+			c.evictions.Add(1)
 		}
 	}
 	c.mu.Unlock()
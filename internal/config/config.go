@@ -11,11 +11,20 @@ import (
 )
 
 type Config struct {
-	Env        string     `yaml:"env"`
-	Database   Database   `yaml:"database"`
-	HTTPServer HTTPServer `yaml:"http_server"`
-	Kafka      Kafka      `yaml:"kafka"`
-	Cache      Cache      `yaml:"cache"`
+	Env         string      `yaml:"env"`
+	Database    Database    `yaml:"database"`
+	Storage     Storage     `yaml:"storage"`
+	HTTPServer  HTTPServer  `yaml:"http_server"`
+	Kafka       Kafka       `yaml:"kafka"`
+	Cache       Cache       `yaml:"cache"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Auth        Auth        `yaml:"auth"`
+	RateLimit   RateLimit   `yaml:"rate_limit"`
+	Encryption  Encryption  `yaml:"encryption"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Health      Health      `yaml:"health"`
+	// ShutdownTimeout - общее время на остановку всех компонентов по сигналу
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"30s"`
 }
 
 type HTTPServer struct {
@@ -28,17 +37,166 @@ type Database struct {
 	DB_CONNECTION_STRING string `yaml:"db_connection_string"`
 }
 
+type Storage struct {
+	// Driver - postgres (DB_CONNECTION_STRING обязателен) или sqlite (встроенная БД, без внешних зависимостей)
+	Driver string `yaml:"driver" env:"STORAGE_DRIVER" env-default:"postgres"`
+	// SQLitePath - файл БД для driver: sqlite; ":memory:" - данные живут до остановки процесса
+	SQLitePath string `yaml:"sqlite_path" env:"STORAGE_SQLITE_PATH" env-default:"wb.db"`
+}
+
 type Kafka struct {
 	Brokers []string `yaml:"brokers"`
 	Topic   string   `yaml:"topic"`
+	// Topics - несколько входящих топиков; если задан, topic не используется
+	Topics  []string `yaml:"topics"`
 	GroupID string   `yaml:"group_id"`
 	Version string   `yaml:"version"`
+	// InitialOffset - откуда читать партицию, для которой у группы ещё нет смещения: newest (только новые) или oldest (с начала)
+	InitialOffset string `yaml:"initial_offset" env:"KAFKA_INITIAL_OFFSET" env-default:"newest"`
+	// RebalanceStrategy - распределение партиций между участниками группы: range, roundrobin или sticky.
+	// Кооперативная (инкрементальная) ребалансировка не поддерживается клиентом sarama: значения
+	// cooperative и cooperative-sticky отклоняются при старте, все стратегии работают по eager-протоколу
+	RebalanceStrategy string `yaml:"rebalance_strategy" env:"KAFKA_REBALANCE_STRATEGY" env-default:"range"`
+	// SessionTimeout - через сколько без heartbeat участник исключается из группы
+	SessionTimeout    time.Duration `yaml:"session_timeout" env-default:"10s"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env-default:"3s"`
+	// RebalanceTimeout - сколько участники ждут друг друга при ребалансировке
+	RebalanceTimeout time.Duration `yaml:"rebalance_timeout" env-default:"60s"`
+	// Workers - параллельные обработчики на партицию; сообщения с одним ключом (order_uid) идут по порядку
+	Workers int `yaml:"workers" env:"KAFKA_WORKERS" env-default:"4"`
+	// BatchSize - сколько заказов обработчик копит для записи одной транзакцией; 1 - запись по одному
+	BatchSize int `yaml:"batch_size" env:"KAFKA_BATCH_SIZE" env-default:"100"`
+	// BatchTimeout - сколько неполная пачка ждёт новых сообщений перед записью
+	BatchTimeout time.Duration `yaml:"batch_timeout" env:"KAFKA_BATCH_TIMEOUT" env-default:"50ms"`
+	TLS          KafkaTLS      `yaml:"tls"`
+	SASL         KafkaSASL     `yaml:"sasl"`
+	Decoding     KafkaDecoding `yaml:"decoding"`
+	Breaker      KafkaBreaker  `yaml:"breaker"`
+}
+
+// TopicList возвращает входящие топики: topics или единственный topic
+func (k Kafka) TopicList() []string {
+	if len(k.Topics) > 0 {
+		return k.Topics
+	}
+	if k.Topic != "" {
+		return []string{k.Topic}
+	}
+	return nil
+}
+
+// KafkaDecoding - разбор сообщений разных форматов (см. internal/decode)
+type KafkaDecoding struct {
+	// AvroSchemaDir - каталог схем Avro <id>.avsc вместо schema registry; пусто - Avro не принимается
+	AvroSchemaDir string `yaml:"avro_schema_dir" env:"KAFKA_AVRO_SCHEMA_DIR" env-default:"api/avro"`
+}
+
+// KafkaBreaker - автомат защиты хранилища: если запись в БД раз за разом не удаётся, consumer ставит
+// партиции на паузу и возобновляет чтение, когда проверка БД проходит
+type KafkaBreaker struct {
+	// FailureThreshold - сколько записей подряд должно не удаться из-за недоступности БД; 0 - автомат выключен
+	FailureThreshold int `yaml:"failure_threshold" env:"KAFKA_BREAKER_FAILURE_THRESHOLD" env-default:"5"`
+	// ProbeInterval - как часто на паузе проверяется доступность БД
+	ProbeInterval time.Duration `yaml:"probe_interval" env:"KAFKA_BREAKER_PROBE_INTERVAL" env-default:"5s"`
+}
+
+// KafkaTLS - шифрование соединений с брокерами; общее для consumer, producer и служебных команд
+type KafkaTLS struct {
+	Enabled bool `yaml:"enabled" env:"KAFKA_TLS_ENABLED"`
+	// CAFile - PEM с сертификатами CA брокеров; пусто - системные корневые сертификаты
+	CAFile string `yaml:"ca_file" env:"KAFKA_TLS_CA_FILE"`
+	// CertFile и KeyFile - клиентский сертификат для mTLS
+	CertFile string `yaml:"cert_file" env:"KAFKA_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"KAFKA_TLS_KEY_FILE"`
+	// InsecureSkipVerify отключает проверку сертификата брокера - только для разработки
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// KafkaSASL - аутентификация на брокерах
+type KafkaSASL struct {
+	// Mechanism - PLAIN, SCRAM-SHA-256 или SCRAM-SHA-512; пусто - без аутентификации
+	Mechanism string `yaml:"mechanism" env:"KAFKA_SASL_MECHANISM"`
+	Username  string `yaml:"username" env:"KAFKA_SASL_USERNAME"`
+	Password  string `yaml:"password" env:"KAFKA_SASL_PASSWORD"`
 }
 
 type Cache struct {
 	TTL time.Duration `yaml:"ttl"`
 }
 
+type Idempotency struct {
+	TTL             time.Duration `yaml:"ttl" env-default:"24h"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"10m"`
+}
+
+type Auth struct {
+	Enabled bool `yaml:"enabled"`
+	// APIKeys - ключи прямо в конфиге; в config.yaml из репозитория их нет, ключи задаются
+	// файлом APIKeysFile или переменной AUTH_API_KEYS
+	APIKeys []APIKey `yaml:"api_keys"`
+	// APIKeysFile - JSON-файл со списком ключей [{"name": ..., "key": ..., "role": ...}]
+	APIKeysFile string `yaml:"api_keys_file" env:"AUTH_API_KEYS_FILE"`
+	// APIKeysEnv - ключи из окружения в формате name:role:key через запятую
+	APIKeysEnv string `yaml:"-" env:"AUTH_API_KEYS"`
+	// AnonymousRole - роль клиента при выключенной аутентификации (в env prod выключать её нельзя)
+	AnonymousRole string `yaml:"anonymous_role" env:"AUTH_ANONYMOUS_ROLE" env-default:"reader"`
+	JWT           JWT    `yaml:"jwt"`
+}
+
+type APIKey struct {
+	Name string `yaml:"name" json:"name"`
+	Key  string `yaml:"key" json:"key"`
+	Role string `yaml:"role" json:"role"`
+}
+
+type JWT struct {
+	HS256Secret string `yaml:"hs256_secret" env:"AUTH_JWT_HS256_SECRET"`
+	JWKSFile    string `yaml:"jwks_file"`
+	Issuer      string `yaml:"issuer"`
+	Audience    string `yaml:"audience"`
+	RoleClaim   string `yaml:"role_claim" env-default:"role"`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend - где хранится состояние корзин: memory (на реплику) или postgres (общее для всех реплик)
+	Backend string `yaml:"backend" env-default:"memory"`
+	Default Limit  `yaml:"default"`
+	// Routes - лимиты отдельных маршрутов, ключ "METHOD /path" как в маршрутах Echo (например "GET /order")
+	Routes map[string]Limit `yaml:"routes"`
+}
+
+type Limit struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+type Encryption struct {
+	// KeyFile - JSON с ключами шифрования персональных данных; пустой путь выключает шифрование
+	KeyFile string `yaml:"key_file" env:"ENCRYPTION_KEY_FILE"`
+}
+
+type Tracing struct {
+	Enabled     bool   `yaml:"enabled"`
+	ServiceName string `yaml:"service_name" env-default:"wb-orders"`
+	// Exporter - otlp (HTTP), stdout или file
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"otlp"`
+	// Endpoint - адрес OTLP/HTTP коллектора (host:port); пусто - из OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure bool   `yaml:"insecure"`
+	// File - куда пишет экспортёр file (JSON по span на строку)
+	File string `yaml:"file" env-default:"traces.json"`
+	// SampleRatio - доля сэмплируемых трасс без родителя, от 0 до 1
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+type Health struct {
+	// CheckTimeout - предельное время одной проверки в /readyz
+	CheckTimeout time.Duration `yaml:"check_timeout" env-default:"2s"`
+	// ConsumerStallTimeout - сколько consumer может не обрабатывать сообщения при ненулевом отставании
+	ConsumerStallTimeout time.Duration `yaml:"consumer_stall_timeout" env-default:"2m"`
+}
+
 var (
 	configPath           string
 	DB_connection_string string
@@ -57,12 +215,6 @@ func NewConfig() *Config {
 		log.Fatal("CONFIG_PATH is not set")
 	}
 
-	if DB_connection_string == "" {
-		log.Fatal("DB_CONNECTION_STRING is not set")
-	}
-
-	cfg.Database.DB_CONNECTION_STRING = DB_connection_string
-
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("config file does not exist: %s", configPath)
 	}
@@ -71,19 +223,41 @@ func NewConfig() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	// Строка подключения нужна только PostgreSQL: со storage.driver: sqlite сервис запускается без внешней БД
+	if cfg.Storage.Driver == "postgres" && DB_connection_string == "" {
+		log.Fatal("DB_CONNECTION_STRING is not set")
+	}
+	cfg.Database.DB_CONNECTION_STRING = DB_connection_string
+
 	// Позволяем переопределять брокеры через переменную окружения (для удобства локального/compose запуска)
-	if brokersEnv := os.Getenv("KAFKA_BROKERS"); brokersEnv != "" {
-		// формат: host1:9092,host2:9092
-		var list []string
-		for _, b := range strings.Split(brokersEnv, ",") {
-			if trimmed := strings.TrimSpace(b); trimmed != "" {
-				list = append(list, trimmed)
-			}
-		}
-		if len(list) > 0 {
-			cfg.Kafka.Brokers = list
-		}
+	if list := brokersFromEnv(); len(list) > 0 {
+		cfg.Kafka.Brokers = list
 	}
 
 	return &cfg
 }
+
+// NewKafkaFromEnv читает настройки Kafka только из окружения - для утилит без конфиг-файла (cmd/producer).
+// Брокеры берутся из KAFKA_BROKERS, по умолчанию localhost:9092
+func NewKafkaFromEnv() (Kafka, error) {
+	var kc Kafka
+	if err := cleanenv.ReadEnv(&kc); err != nil {
+		return kc, err
+	}
+	kc.Brokers = brokersFromEnv()
+	if len(kc.Brokers) == 0 {
+		kc.Brokers = []string{"localhost:9092"}
+	}
+	return kc, nil
+}
+
+// brokersFromEnv разбирает KAFKA_BROKERS в формате host1:9092,host2:9092
+func brokersFromEnv() []string {
+	var list []string
+	for _, b := range strings.Split(os.Getenv("KAFKA_BROKERS"), ",") {
+		if trimmed := strings.TrimSpace(b); trimmed != "" {
+			list = append(list, trimmed)
+		}
+	}
+	return list
+}
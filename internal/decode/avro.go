@@ -0,0 +1,185 @@
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"WB2/internal/dto/request"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroDecoder разбирает Avro-заказы по схемам писателя из локального каталога - замена schema registry.
+// Схема выбирается по id: из заголовка schema-version или из префикса Confluent wire format
+// (нулевой байт и 4 байта id), файл схемы - <dir>/<id>.avsc
+type avroDecoder struct {
+	schemas map[uint32]avro.Schema
+}
+
+func newAvroDecoder(dir string) (*avroDecoder, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.avsc"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no avro schemas (*.avsc) in %s", dir)
+	}
+	d := &avroDecoder{schemas: make(map[uint32]avro.Schema, len(files))}
+	for _, file := range files {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), ".avsc"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("avro schema %s: file name must be a numeric schema id", file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := avro.Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("avro schema %s: %w", file, err)
+		}
+		d.schemas[uint32(id)] = schema
+	}
+	return d, nil
+}
+
+func (d *avroDecoder) Decode(version string, data []byte) (*request.CreateOrderRequest, error) {
+	var id uint32
+	if version != "" {
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return nil, unsupportedVersion("avro", version)
+		}
+		id = uint32(v)
+	} else {
+		if len(data) < 5 || data[0] != 0 {
+			return nil, errors.New("avro message needs a schema-version header or the Confluent wire format prefix")
+		}
+		id = binary.BigEndian.Uint32(data[1:5])
+		data = data[5:]
+	}
+	schema, ok := d.schemas[id]
+	if !ok {
+		return nil, unsupportedVersion("avro", strconv.FormatUint(uint64(id), 10))
+	}
+	// avro.Unmarshal считает конец данных посреди записи успешным разбором, и обрезанное сообщение
+	// превратилось бы в заказ с пустыми полями. Reader без источника сообщает о нём как об io.EOF
+	var o avroOrder
+	r := avro.NewReader(nil, 0).Reset(data)
+	r.ReadVal(schema, &o)
+	if errors.Is(r.Error, io.EOF) {
+		return nil, fmt.Errorf("avro message is truncated: %w", io.ErrUnexpectedEOF)
+	}
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return o.toRequest(), nil
+}
+
+// avroOrder - поля заказа в схемах api/avro. Поля схемы писателя, которых здесь нет, пропускаются
+type avroOrder struct {
+	OrderUID          string       `avro:"order_uid"`
+	TrackNumber       string       `avro:"track_number"`
+	Entry             string       `avro:"entry"`
+	Delivery          avroDelivery `avro:"delivery"`
+	Payment           avroPayment  `avro:"payment"`
+	Items             []avroItem   `avro:"items"`
+	Locale            string       `avro:"locale"`
+	InternalSignature string       `avro:"internal_signature"`
+	CustomerID        string       `avro:"customer_id"`
+	DeliveryService   string       `avro:"delivery_service"`
+	ShardKey          string       `avro:"shardkey"`
+	SmID              int64        `avro:"sm_id"`
+	OofShard          string       `avro:"oof_shard"`
+	DateCreated       *time.Time   `avro:"date_created"`
+}
+
+type avroDelivery struct {
+	Name    string `avro:"name"`
+	Phone   string `avro:"phone"`
+	Zip     string `avro:"zip"`
+	City    string `avro:"city"`
+	Address string `avro:"address"`
+	Region  string `avro:"region"`
+	Email   string `avro:"email"`
+}
+
+type avroPayment struct {
+	Transaction  string `avro:"transaction"`
+	RequestID    string `avro:"request_id"`
+	Currency     string `avro:"currency"`
+	Provider     string `avro:"provider"`
+	Amount       int64  `avro:"amount"`
+	PaymentDt    int64  `avro:"payment_dt"`
+	Bank         string `avro:"bank"`
+	DeliveryCost int64  `avro:"delivery_cost"`
+	GoodsTotal   int64  `avro:"goods_total"`
+	CustomFee    int64  `avro:"custom_fee"`
+}
+
+type avroItem struct {
+	ChrtID      int64  `avro:"chrt_id"`
+	TrackNumber string `avro:"track_number"`
+	Price       int64  `avro:"price"`
+	Rid         string `avro:"rid"`
+	Name        string `avro:"name"`
+	Sale        int64  `avro:"sale"`
+	Size        string `avro:"size"`
+	TotalPrice  int64  `avro:"total_price"`
+	NmID        int64  `avro:"nm_id"`
+	Brand       string `avro:"brand"`
+	Status      int32  `avro:"status"`
+}
+
+func (o *avroOrder) toRequest() *request.CreateOrderRequest {
+	req := &request.CreateOrderRequest{
+		OrderUID:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerID:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		ShardKey:          o.ShardKey,
+		SmID:              int(o.SmID),
+		OofShard:          o.OofShard,
+		DateCreated:       o.DateCreated,
+		Delivery:          request.CreateDeliveryRequest(o.Delivery),
+		Payment: request.CreatePaymentRequest{
+			Transaction:  o.Payment.Transaction,
+			RequestID:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       int(o.Payment.Amount),
+			PaymentDt:    o.Payment.PaymentDt,
+			Bank:         o.Payment.Bank,
+			DeliveryCost: int(o.Payment.DeliveryCost),
+			GoodsTotal:   int(o.Payment.GoodsTotal),
+			CustomFee:    int(o.Payment.CustomFee),
+		},
+		Items: make([]request.CreateItemRequest, len(o.Items)),
+	}
+	for i, it := range o.Items {
+		req.Items[i] = request.CreateItemRequest{
+			ChrtID:      int(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int(it.Price),
+			Rid:         it.Rid,
+			Name:        it.Name,
+			Sale:        int(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int(it.TotalPrice),
+			NmID:        int(it.NmID),
+			Brand:       it.Brand,
+			Status:      int(it.Status),
+		}
+	}
+	return req
+}
@@ -0,0 +1,92 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"WB2/internal/dto/request"
+)
+
+// Заголовки сообщения, по которым выбирается декодер
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// Типы содержимого; сообщение без content-type считается JSON
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+	// ContentTypeEvent - конверт события заказа (см. event.go)
+	ContentTypeEvent = "application/vnd.wb.order-event+json"
+)
+
+// ErrUnsupported - для сообщения нет декодера: неизвестный content-type или версия схемы
+var ErrUnsupported = errors.New("unsupported message format")
+
+// Decoder разбирает тело сообщения одного типа содержимого в запрос на создание заказа.
+// version - значение заголовка schema-version, может быть пустым
+type Decoder interface {
+	Decode(version string, data []byte) (*request.CreateOrderRequest, error)
+}
+
+// Registry выбирает декодер по заголовку content-type. Заказ в любом формате становится событием
+// order.created, конверт события (ContentTypeEvent) разбирается отдельно
+type Registry struct {
+	decoders map[string]Decoder
+}
+
+// NewRegistry создаёт реестр с JSON (v1, v2), Protobuf и Avro. Схемы Avro читаются из avroSchemaDir
+// (файлы <id>.avsc); пустой путь отключает Avro
+func NewRegistry(avroSchemaDir string) (*Registry, error) {
+	r := &Registry{decoders: make(map[string]Decoder)}
+	r.Register(jsonDecoder{}, ContentTypeJSON, "text/json")
+	r.Register(protobufDecoder{}, ContentTypeProtobuf, "application/protobuf", "application/vnd.google.protobuf")
+	if avroSchemaDir != "" {
+		avro, err := newAvroDecoder(avroSchemaDir)
+		if err != nil {
+			return nil, err
+		}
+		r.Register(avro, ContentTypeAvro, "avro/binary", "application/vnd.apache.avro+binary")
+	}
+	return r, nil
+}
+
+// Register добавляет декодер для одного или нескольких типов содержимого
+func (r *Registry) Register(d Decoder, contentTypes ...string) {
+	for _, ct := range contentTypes {
+		r.decoders[strings.ToLower(ct)] = d
+	}
+}
+
+// Decode разбирает тело сообщения по его заголовкам content-type и schema-version
+func (r *Registry) Decode(contentType, version string, data []byte) (*request.OrderEvent, error) {
+	ct := ContentTypeJSON
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: content-type %q", ErrUnsupported, contentType)
+		}
+		ct = mt
+	}
+	version = strings.TrimSpace(version)
+	if ct == ContentTypeEvent {
+		return decodeEvent(version, data)
+	}
+	d, ok := r.decoders[ct]
+	if !ok {
+		return nil, fmt.Errorf("%w: content-type %q", ErrUnsupported, contentType)
+	}
+	req, err := d.Decode(version, data)
+	if err != nil {
+		return nil, err
+	}
+	return &request.OrderEvent{Type: request.EventOrderCreated, OrderUID: req.OrderUID, Created: req}, nil
+}
+
+func unsupportedVersion(format, version string) error {
+	return fmt.Errorf("%w: %s schema version %q", ErrUnsupported, format, version)
+}
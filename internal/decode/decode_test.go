@@ -0,0 +1,356 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"WB2/internal/dto/request"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// update перезаписывает эталон testdata/order.golden.json: go test ./internal/decode -update
+var update = flag.Bool("update", false, "rewrite golden files")
+
+const avroSchemaDir = "../../api/avro"
+
+// Один и тот же заказ в любом формате и версии схемы должен превращаться в одну и ту же модель заказа
+func TestRegistryDecodesEveryFormatIntoTheSameOrder(t *testing.T) {
+	registry := newTestRegistry(t)
+	v1 := readTestdata(t, "order.v1.json")
+	v2 := readTestdata(t, "order.v2.json")
+	req := decodeV1(t, v1)
+
+	proto := protoOrder(req)
+	// поля, которых нет в схеме, пропускаются
+	proto = protowire.AppendTag(proto, 100, protowire.Fixed32Type)
+	proto = protowire.AppendFixed32(proto, 7)
+	proto = protowire.AppendTag(proto, 101, protowire.BytesType)
+	proto = protowire.AppendString(proto, "future field")
+
+	avroV1 := avroMarshal(t, "1", avroOrderOf(req))
+	promo := "BLACKFRIDAY"
+	avroV2 := avroMarshal(t, "2", avroOrderV2{avroOrder: avroOrderOf(req), PromoCode: &promo})
+	confluentV2 := append([]byte{0, 0, 0, 0, 2}, avroV2...)
+
+	tests := []struct {
+		name        string
+		contentType string
+		version     string
+		data        []byte
+	}{
+		{name: "json without headers", data: v1},
+		{name: "json v1", contentType: ContentTypeJSON, version: "1", data: v1},
+		{name: "json with charset", contentType: "Application/JSON; charset=utf-8", data: v1},
+		{name: "json alias", contentType: "text/json", version: "1", data: v1},
+		{name: "json v2", contentType: ContentTypeJSON, version: "2", data: v2},
+		{name: "json v2 with spaces in version", contentType: ContentTypeJSON, version: " 2 ", data: v2},
+		{name: "protobuf", contentType: ContentTypeProtobuf, data: proto},
+		{name: "protobuf v1", contentType: "application/vnd.google.protobuf", version: "1", data: proto},
+		{name: "avro v1", contentType: ContentTypeAvro, version: "1", data: avroV1},
+		{name: "avro v2 with promo_code", contentType: ContentTypeAvro, version: "2", data: avroV2},
+		{name: "avro v2 confluent wire format", contentType: "application/vnd.apache.avro+binary", data: confluentV2},
+		{
+			name: "event envelope with json v2", contentType: ContentTypeEvent, version: "2",
+			data: []byte(`{"id":"ev-1","type":"order.created","order_uid":"b563feb7b2b84b6test","occurred_at":"2021-11-26T06:22:19Z","payload":` +
+				string(v2) + `}`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := registry.Decode(tt.contentType, tt.version, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Type != request.EventOrderCreated || ev.OrderUID != "b563feb7b2b84b6test" || ev.Created == nil {
+				t.Fatalf("event %s for %q, want order.created for the order", ev.Type, ev.OrderUID)
+			}
+			checkGolden(t, "order.golden.json", ev.Created)
+		})
+	}
+}
+
+func TestRegistryRejectsUnsupportedFormats(t *testing.T) {
+	registry := newTestRegistry(t)
+	v1 := readTestdata(t, "order.v1.json")
+	proto := protoOrder(decodeV1(t, v1))
+
+	tests := []struct {
+		name        string
+		contentType string
+		version     string
+		data        []byte
+	}{
+		{name: "unknown content type", contentType: "application/xml", data: []byte("<order/>")},
+		{name: "malformed content type", contentType: "application/json; =", data: v1},
+		{name: "unknown json version", contentType: ContentTypeJSON, version: "3", data: v1},
+		{name: "unknown protobuf version", contentType: ContentTypeProtobuf, version: "2", data: proto},
+		{name: "unknown avro schema", contentType: ContentTypeAvro, version: "99", data: []byte{0}},
+		{name: "non-numeric avro version", contentType: ContentTypeAvro, version: "v1", data: []byte{0}},
+		{name: "unknown avro schema in wire format", contentType: ContentTypeAvro, data: []byte{0, 0, 0, 0, 99, 0}},
+		{name: "unknown event type", contentType: ContentTypeEvent,
+			data: []byte(`{"type":"order.exploded","order_uid":"x","occurred_at":"2021-11-26T06:22:19Z","payload":{}}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Decode(tt.contentType, tt.version, tt.data)
+			if !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("err = %v, want ErrUnsupported", err)
+			}
+		})
+	}
+
+	// без каталога схем Avro выключен целиком
+	plain, err := NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Decode(ContentTypeAvro, "1", []byte{0}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("avro without schemas: err = %v, want ErrUnsupported", err)
+	}
+}
+
+// Повреждённое сообщение - ошибка разбора, а не неподдерживаемый формат и не пустой заказ
+func TestRegistryRejectsMalformedMessages(t *testing.T) {
+	registry := newTestRegistry(t)
+	req := decodeV1(t, readTestdata(t, "order.v1.json"))
+	proto := protoOrder(req)
+	avroV1 := avroMarshal(t, "1", avroOrderOf(req))
+
+	// order_uid (поле 1) записан числом, а не строкой
+	wrongWireType := protowire.AppendTag(nil, 1, protowire.VarintType)
+	wrongWireType = protowire.AppendVarint(wrongWireType, 42)
+	wrongWireType = append(wrongWireType, proto...)
+	// сумма платежа (поле 5 вложенного Payment) записана строкой
+	wrongNested := protowire.AppendTag(nil, 5, protowire.BytesType)
+	wrongNested = protowire.AppendBytes(wrongNested, protowire.AppendString(protowire.AppendTag(nil, 5, protowire.BytesType), "1817"))
+
+	tests := []struct {
+		name        string
+		contentType string
+		version     string
+		data        []byte
+	}{
+		{name: "truncated protobuf", contentType: ContentTypeProtobuf, data: proto[:len(proto)-3]},
+		{name: "truncated protobuf tag", contentType: ContentTypeProtobuf, data: []byte{0x80}},
+		{name: "protobuf wrong wire type", contentType: ContentTypeProtobuf, data: wrongWireType},
+		{name: "protobuf wrong wire type in nested message", contentType: ContentTypeProtobuf, data: wrongNested},
+		{name: "truncated avro", contentType: ContentTypeAvro, version: "1", data: avroV1[:len(avroV1)/2]},
+		{name: "avro without version or wire format", contentType: ContentTypeAvro, data: avroV1},
+		{name: "broken json", contentType: ContentTypeJSON, data: []byte(`{"order_uid":`)},
+		{name: "event without occurred_at", contentType: ContentTypeEvent,
+			data: []byte(`{"type":"order.cancelled","order_uid":"x","payload":{"reason":"r"}}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := registry.Decode(tt.contentType, tt.version, tt.data)
+			if err == nil {
+				t.Fatalf("decoded %+v, want an error", ev)
+			}
+			if errors.Is(err, ErrUnsupported) {
+				t.Fatalf("err = %v, want a decode error, not ErrUnsupported", err)
+			}
+		})
+	}
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry(avroSchemaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	return readFile(t, filepath.Join("testdata", name))
+}
+
+func decodeV1(t *testing.T, data []byte) *request.CreateOrderRequest {
+	t.Helper()
+	req, err := jsonDecoder{}.Decode("1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// checkGolden сравнивает модель заказа из req с эталоном testdata/name
+func checkGolden(t *testing.T, name string, req *request.CreateOrderRequest) {
+	t.Helper()
+	got, err := json.MarshalIndent(req.ToOrderModel(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := readTestdata(t, name)
+	if !bytes.Equal(got, want) {
+		t.Errorf("order differs from %s:\n%s", path, got)
+	}
+}
+
+// protoOrder кодирует заказ по схеме api/order.proto
+func protoOrder(req *request.CreateOrderRequest) []byte {
+	var b []byte
+	b = protoString(b, 1, req.OrderUID)
+	b = protoString(b, 2, req.TrackNumber)
+	b = protoString(b, 3, req.Entry)
+
+	var d []byte
+	d = protoString(d, 1, req.Delivery.Name)
+	d = protoString(d, 2, req.Delivery.Phone)
+	d = protoString(d, 3, req.Delivery.Zip)
+	d = protoString(d, 4, req.Delivery.City)
+	d = protoString(d, 5, req.Delivery.Address)
+	d = protoString(d, 6, req.Delivery.Region)
+	d = protoString(d, 7, req.Delivery.Email)
+	b = protoMessage(b, 4, d)
+
+	p := req.Payment
+	var pb []byte
+	pb = protoString(pb, 1, p.Transaction)
+	pb = protoString(pb, 2, p.RequestID)
+	pb = protoString(pb, 3, p.Currency)
+	pb = protoString(pb, 4, p.Provider)
+	pb = protoInt(pb, 5, int64(p.Amount))
+	pb = protoInt(pb, 6, p.PaymentDt)
+	pb = protoString(pb, 7, p.Bank)
+	pb = protoInt(pb, 8, int64(p.DeliveryCost))
+	pb = protoInt(pb, 9, int64(p.GoodsTotal))
+	pb = protoInt(pb, 10, int64(p.CustomFee))
+	b = protoMessage(b, 5, pb)
+
+	for _, it := range req.Items {
+		var ib []byte
+		ib = protoInt(ib, 1, int64(it.ChrtID))
+		ib = protoString(ib, 2, it.TrackNumber)
+		ib = protoInt(ib, 3, int64(it.Price))
+		ib = protoString(ib, 4, it.Rid)
+		ib = protoString(ib, 5, it.Name)
+		ib = protoInt(ib, 6, int64(it.Sale))
+		ib = protoString(ib, 7, it.Size)
+		ib = protoInt(ib, 8, int64(it.TotalPrice))
+		ib = protoInt(ib, 9, int64(it.NmID))
+		ib = protoString(ib, 10, it.Brand)
+		ib = protoInt(ib, 11, int64(it.Status))
+		b = protoMessage(b, 6, ib)
+	}
+
+	b = protoString(b, 7, req.Locale)
+	b = protoString(b, 8, req.InternalSignature)
+	b = protoString(b, 9, req.CustomerID)
+	b = protoString(b, 10, req.DeliveryService)
+	b = protoString(b, 11, req.ShardKey)
+	b = protoInt(b, 12, int64(req.SmID))
+	b = protoString(b, 13, req.OofShard)
+	if req.DateCreated != nil {
+		var ts []byte
+		ts = protoInt(ts, 1, req.DateCreated.Unix())
+		ts = protoInt(ts, 2, int64(req.DateCreated.Nanosecond()))
+		b = protoMessage(b, 14, ts)
+	}
+	return b
+}
+
+func protoString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func protoInt(b []byte, num protowire.Number, v int64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func protoMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// avroOrderV2 - заказ схемы 2 (api/avro/2.avsc), которая добавила промокод
+type avroOrderV2 struct {
+	avroOrder
+	PromoCode *string `avro:"promo_code"`
+}
+
+func avroOrderOf(req *request.CreateOrderRequest) avroOrder {
+	o := avroOrder{
+		OrderUID:          req.OrderUID,
+		TrackNumber:       req.TrackNumber,
+		Entry:             req.Entry,
+		Delivery:          avroDelivery(req.Delivery),
+		Locale:            req.Locale,
+		InternalSignature: req.InternalSignature,
+		CustomerID:        req.CustomerID,
+		DeliveryService:   req.DeliveryService,
+		ShardKey:          req.ShardKey,
+		SmID:              int64(req.SmID),
+		OofShard:          req.OofShard,
+		DateCreated:       req.DateCreated,
+		Payment: avroPayment{
+			Transaction:  req.Payment.Transaction,
+			RequestID:    req.Payment.RequestID,
+			Currency:     req.Payment.Currency,
+			Provider:     req.Payment.Provider,
+			Amount:       int64(req.Payment.Amount),
+			PaymentDt:    req.Payment.PaymentDt,
+			Bank:         req.Payment.Bank,
+			DeliveryCost: int64(req.Payment.DeliveryCost),
+			GoodsTotal:   int64(req.Payment.GoodsTotal),
+			CustomFee:    int64(req.Payment.CustomFee),
+		},
+	}
+	for _, it := range req.Items {
+		o.Items = append(o.Items, avroItem{
+			ChrtID:      int64(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int64(it.Price),
+			Rid:         it.Rid,
+			Name:        it.Name,
+			Sale:        int64(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int64(it.TotalPrice),
+			NmID:        int64(it.NmID),
+			Brand:       it.Brand,
+			Status:      int32(it.Status),
+		})
+	}
+	return o
+}
+
+// avroMarshal кодирует v схемой api/avro/<id>.avsc
+func avroMarshal(t *testing.T, id string, v any) []byte {
+	t.Helper()
+	schema, err := avro.Parse(string(readFile(t, filepath.Join(avroSchemaDir, id+".avsc"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := avro.Marshal(schema, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+package decode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"WB2/internal/dto/request"
+)
+
+// envelope - конверт события заказа (content-type application/vnd.wb.order-event+json):
+//
+//	{"id": "...", "type": "order.cancelled", "order_uid": "...", "occurred_at": "2024-05-01T10:00:00Z", "payload": {...}}
+//
+// id необязателен: без него повтор распознаётся по совпадению тела сообщения
+type envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OrderUID   string          `json:"order_uid"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// decodeEvent разбирает конверт и его полезную нагрузку. Заказ в order.created - JSON той версии,
+// что указана в schema-version; order_uid полезной нагрузки, если он не задан, берётся из конверта
+func decodeEvent(version string, data []byte) (*request.OrderEvent, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	if env.Type == "" {
+		return nil, errors.New("event type is required")
+	}
+	if env.OccurredAt.IsZero() {
+		return nil, errors.New("event occurred_at is required")
+	}
+	if len(env.Payload) == 0 || string(env.Payload) == "null" {
+		return nil, fmt.Errorf("event %s has no payload", env.Type)
+	}
+	ev := &request.OrderEvent{ID: env.ID, Type: env.Type, OrderUID: env.OrderUID, OccurredAt: env.OccurredAt}
+	if ev.ID == "" {
+		sum := sha256.Sum256(data)
+		ev.ID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	var err error
+	switch env.Type {
+	case request.EventOrderCreated:
+		ev.Created, err = jsonDecoder{}.Decode(version, env.Payload)
+		if err == nil && ev.Created.OrderUID == "" {
+			ev.Created.OrderUID = env.OrderUID
+		}
+	case request.EventOrderUpdated:
+		ev.Updated = &request.UpdateOrderRequest{}
+		err = json.Unmarshal(env.Payload, ev.Updated)
+		if ev.Updated.OrderUID == "" {
+			ev.Updated.OrderUID = env.OrderUID
+		}
+	case request.EventOrderCancelled:
+		ev.Cancelled = &request.CancelOrderRequest{}
+		err = json.Unmarshal(env.Payload, ev.Cancelled)
+	case request.EventPaymentCaptured:
+		ev.PaymentCaptured = &request.CapturePaymentRequest{}
+		err = json.Unmarshal(env.Payload, ev.PaymentCaptured)
+	case request.EventItemStatusChanged:
+		ev.ItemStatus = &request.ItemStatusRequest{}
+		err = json.Unmarshal(env.Payload, ev.ItemStatus)
+	default:
+		return nil, fmt.Errorf("%w: event type %q", ErrUnsupported, env.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("event %s payload: %w", env.Type, err)
+	}
+	return ev, nil
+}
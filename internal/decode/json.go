@@ -0,0 +1,113 @@
+package decode
+
+import (
+	"encoding/json"
+	"time"
+
+	"WB2/internal/dto/request"
+)
+
+// jsonDecoder разбирает JSON заказа. Версия 1 (по умолчанию) - формат POST /order и OrderResponse,
+// версия 2 - формат с группировкой полей покупателя, доставки и шардирования (orderV2)
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(version string, data []byte) (*request.CreateOrderRequest, error) {
+	switch version {
+	case "", "1":
+		var req request.CreateOrderRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		return &req, nil
+	case "2":
+		var v2 orderV2
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		return v2.toRequest(), nil
+	}
+	return nil, unsupportedVersion("json", version)
+}
+
+// orderV2 - JSON заказа версии 2. Неизвестные поля игнорируются, поэтому новые поля
+// можно добавлять без смены версии
+type orderV2 struct {
+	OrderUID    string `json:"order_uid"`
+	TrackNumber string `json:"track_number"`
+	Entry       string `json:"entry"`
+	Locale      string `json:"locale"`
+	Customer    struct {
+		ID        string `json:"id"`
+		Signature string `json:"signature"`
+	} `json:"customer"`
+	Delivery struct {
+		Service string `json:"service"`
+		Name    string `json:"name"`
+		Phone   string `json:"phone"`
+		Zip     string `json:"zip"`
+		City    string `json:"city"`
+		Address string `json:"address"`
+		Region  string `json:"region"`
+		Email   string `json:"email"`
+	} `json:"delivery"`
+	Payment struct {
+		Transaction  string    `json:"transaction"`
+		RequestID    string    `json:"request_id"`
+		Currency     string    `json:"currency"`
+		Provider     string    `json:"provider"`
+		Amount       int       `json:"amount"`
+		PaidAt       time.Time `json:"paid_at"`
+		Bank         string    `json:"bank"`
+		DeliveryCost int       `json:"delivery_cost"`
+		GoodsTotal   int       `json:"goods_total"`
+		CustomFee    int       `json:"custom_fee"`
+	} `json:"payment"`
+	Items []request.CreateItemRequest `json:"items"`
+	Shard struct {
+		Key  string `json:"key"`
+		SmID int    `json:"sm_id"`
+		Oof  string `json:"oof"`
+	} `json:"shard"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+func (o *orderV2) toRequest() *request.CreateOrderRequest {
+	req := &request.CreateOrderRequest{
+		OrderUID:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Locale:            o.Locale,
+		InternalSignature: o.Customer.Signature,
+		CustomerID:        o.Customer.ID,
+		DeliveryService:   o.Delivery.Service,
+		ShardKey:          o.Shard.Key,
+		SmID:              o.Shard.SmID,
+		OofShard:          o.Shard.Oof,
+		DateCreated:       o.CreatedAt,
+		Delivery: request.CreateDeliveryRequest{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: request.CreatePaymentRequest{
+			Transaction:  o.Payment.Transaction,
+			RequestID:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       o.Payment.Amount,
+			Bank:         o.Payment.Bank,
+			DeliveryCost: o.Payment.DeliveryCost,
+			GoodsTotal:   o.Payment.GoodsTotal,
+			CustomFee:    o.Payment.CustomFee,
+		},
+		Items: o.Items,
+	}
+	if !o.Payment.PaidAt.IsZero() {
+		req.Payment.PaymentDt = o.Payment.PaidAt.Unix()
+	}
+	return req
+}
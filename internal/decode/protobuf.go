@@ -0,0 +1,229 @@
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"WB2/internal/dto/request"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufDecoder разбирает заказ по схеме api/order.proto (wb.orders.v1.Order) без сгенерированного кода.
+// Неизвестные поля пропускаются, как у обычного protobuf-парсера, а известное поле с чужим wire type - ошибка
+type protobufDecoder struct{}
+
+// Wire type полей сообщений api/order.proto: все поля с номерами до последнего - строки или вложенные
+// сообщения, кроме перечисленных числовых
+var (
+	orderWireTypes     = wireTypes(14, 12)
+	deliveryWireTypes  = wireTypes(7)
+	paymentWireTypes   = wireTypes(10, 5, 6, 8, 9, 10)
+	itemWireTypes      = wireTypes(11, 1, 3, 6, 8, 9, 11)
+	timestampWireTypes = wireTypes(2, 1, 2)
+)
+
+type fieldWireTypes map[protowire.Number]protowire.Type
+
+// wireTypes описывает сообщение с полями 1..last, где varints - числовые поля, остальные length-delimited
+func wireTypes(last protowire.Number, varints ...protowire.Number) fieldWireTypes {
+	types := make(fieldWireTypes, last)
+	for num := protowire.Number(1); num <= last; num++ {
+		types[num] = protowire.BytesType
+	}
+	for _, num := range varints {
+		types[num] = protowire.VarintType
+	}
+	return types
+}
+
+func (protobufDecoder) Decode(version string, data []byte) (*request.CreateOrderRequest, error) {
+	if version != "" && version != "1" {
+		return nil, unsupportedVersion("protobuf", version)
+	}
+	var req request.CreateOrderRequest
+	err := protoFields(data, orderWireTypes, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			req.OrderUID = string(b)
+		case 2:
+			req.TrackNumber = string(b)
+		case 3:
+			req.Entry = string(b)
+		case 4:
+			return protoDelivery(b, &req.Delivery)
+		case 5:
+			return protoPayment(b, &req.Payment)
+		case 6:
+			var item request.CreateItemRequest
+			if err := protoItem(b, &item); err != nil {
+				return err
+			}
+			req.Items = append(req.Items, item)
+		case 7:
+			req.Locale = string(b)
+		case 8:
+			req.InternalSignature = string(b)
+		case 9:
+			req.CustomerID = string(b)
+		case 10:
+			req.DeliveryService = string(b)
+		case 11:
+			req.ShardKey = string(b)
+		case 12:
+			req.SmID = int(int64(v))
+		case 13:
+			req.OofShard = string(b)
+		case 14:
+			t, err := protoTimestamp(b)
+			if err != nil {
+				return err
+			}
+			req.DateCreated = &t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func protoDelivery(data []byte, d *request.CreateDeliveryRequest) error {
+	return protoFields(data, deliveryWireTypes, func(num protowire.Number, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			d.Name = string(b)
+		case 2:
+			d.Phone = string(b)
+		case 3:
+			d.Zip = string(b)
+		case 4:
+			d.City = string(b)
+		case 5:
+			d.Address = string(b)
+		case 6:
+			d.Region = string(b)
+		case 7:
+			d.Email = string(b)
+		}
+		return nil
+	})
+}
+
+func protoPayment(data []byte, p *request.CreatePaymentRequest) error {
+	return protoFields(data, paymentWireTypes, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			p.Transaction = string(b)
+		case 2:
+			p.RequestID = string(b)
+		case 3:
+			p.Currency = string(b)
+		case 4:
+			p.Provider = string(b)
+		case 5:
+			p.Amount = int(int64(v))
+		case 6:
+			p.PaymentDt = int64(v)
+		case 7:
+			p.Bank = string(b)
+		case 8:
+			p.DeliveryCost = int(int64(v))
+		case 9:
+			p.GoodsTotal = int(int64(v))
+		case 10:
+			p.CustomFee = int(int64(v))
+		}
+		return nil
+	})
+}
+
+func protoItem(data []byte, it *request.CreateItemRequest) error {
+	return protoFields(data, itemWireTypes, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			it.ChrtID = int(int64(v))
+		case 2:
+			it.TrackNumber = string(b)
+		case 3:
+			it.Price = int(int64(v))
+		case 4:
+			it.Rid = string(b)
+		case 5:
+			it.Name = string(b)
+		case 6:
+			it.Sale = int(int64(v))
+		case 7:
+			it.Size = string(b)
+		case 8:
+			it.TotalPrice = int(int64(v))
+		case 9:
+			it.NmID = int(int64(v))
+		case 10:
+			it.Brand = string(b)
+		case 11:
+			it.Status = int(int32(v))
+		}
+		return nil
+	})
+}
+
+// protoTimestamp разбирает google.protobuf.Timestamp
+func protoTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := protoFields(data, timestampWireTypes, func(num protowire.Number, v uint64, _ []byte) error {
+		switch num {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(int32(v))
+		}
+		return nil
+	})
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+// protoFields перебирает поля сообщения: для varint-полей в fn передаётся значение, для length-delimited
+// (строки, вложенные сообщения) - байты. Поля остальных типов в схеме заказа не используются и пропускаются.
+// Если wire type поля из types не совпадает с ожидаемым, сообщение записано по другой схеме - это ошибка,
+// а не пустое значение
+func protoFields(data []byte, types fieldWireTypes, fn func(num protowire.Number, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if want, ok := types[num]; ok && typ != want {
+			return fmt.Errorf("protobuf field %d: wire type %d, want %d", num, typ, want)
+		}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			if err := fn(num, 0, b); err != nil {
+				return err
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package request
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrBatchTooLarge - в пакете больше записей, чем допускает лимит
+var ErrBatchTooLarge = errors.New("batch is too large")
+
+// BatchEntry - одна запись пакетного импорта: разобранный запрос либо ошибка разбора
+type BatchEntry struct {
+	Request *CreateOrderRequest
+	Err     error
+}
+
+// DecodeOrderBatch читает пакет заказов из JSON-массива или NDJSON-потока (формат определяется по первому символу).
+// Синтаксическая ошибка прерывает разбор целиком, ошибка типов полей относится только к своей записи
+func DecodeOrderBatch(r io.Reader, limit int) ([]BatchEntry, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, errors.New("empty batch")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	isArray := first == '['
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []BatchEntry
+	for {
+		if isArray && !dec.More() {
+			break
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if !isArray && err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("record %d: %w", len(entries), err)
+		}
+		if len(entries) == limit {
+			return nil, fmt.Errorf("%w: more than %d records", ErrBatchTooLarge, limit)
+		}
+		var req CreateOrderRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			entries = append(entries, BatchEntry{Err: err})
+			continue
+		}
+		entries = append(entries, BatchEntry{Request: &req})
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("empty batch")
+	}
+	return entries, nil
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
@@ -0,0 +1,101 @@
+package request
+
+import (
+	"fmt"
+	"time"
+)
+
+// Типы событий заказа во входящем топике
+const (
+	EventOrderCreated      = "order.created"
+	EventOrderUpdated      = "order.updated"
+	EventOrderCancelled    = "order.cancelled"
+	EventPaymentCaptured   = "payment.captured"
+	EventItemStatusChanged = "item.status_changed"
+)
+
+// OrderEvent - событие заказа из Kafka. Заполнено ровно одно поле полезной нагрузки, соответствующее Type.
+// Сообщение без конверта (просто заказ) становится событием order.created
+type OrderEvent struct {
+	// ID - идентификатор события для распознавания повторов; если producer его не передал,
+	// это хеш тела сообщения
+	ID         string
+	Type       string
+	OrderUID   string
+	OccurredAt time.Time
+
+	Created         *CreateOrderRequest
+	Updated         *UpdateOrderRequest
+	Cancelled       *CancelOrderRequest
+	PaymentCaptured *CapturePaymentRequest
+	ItemStatus      *ItemStatusRequest
+}
+
+// CancelOrderRequest - полезная нагрузка order.cancelled
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CapturePaymentRequest - полезная нагрузка payment.captured. Непустые transaction и amount
+// сверяются с платежом заказа
+type CapturePaymentRequest struct {
+	Transaction string `json:"transaction"`
+	Amount      int    `json:"amount"`
+}
+
+// ItemStatusRequest - полезная нагрузка item.status_changed; товар ищется по rid
+type ItemStatusRequest struct {
+	Rid    string `json:"rid"`
+	Status int    `json:"status"`
+}
+
+// Subject - объект внутри заказа, к которому относится событие (rid товара для item.status_changed).
+// Порядок событий по occurred_at сравнивается в пределах заказа, типа события и объекта
+func (e *OrderEvent) Subject() string {
+	if e.ItemStatus != nil {
+		return e.ItemStatus.Rid
+	}
+	return ""
+}
+
+// Validate проверяет конверт и полезную нагрузку события
+func (e *OrderEvent) Validate() error {
+	var f fieldErrors
+	f.required("order_uid", e.OrderUID)
+	switch e.Type {
+	case EventOrderCreated:
+		if e.Created == nil {
+			f.add("payload", "is required")
+		} else if e.Created.OrderUID != e.OrderUID {
+			f.add("payload.order_uid", "does not match the event order_uid")
+		}
+	case EventOrderUpdated:
+		if e.Updated == nil {
+			f.add("payload", "is required")
+		} else if e.Updated.OrderUID != e.OrderUID {
+			f.add("payload.order_uid", "does not match the event order_uid")
+		}
+	case EventOrderCancelled:
+		if e.Cancelled == nil {
+			f.add("payload", "is required")
+		}
+	case EventPaymentCaptured:
+		if e.PaymentCaptured == nil {
+			f.add("payload", "is required")
+		} else if e.PaymentCaptured.Amount < 0 {
+			f.add("payload.amount", "must be >= 0")
+		}
+	case EventItemStatusChanged:
+		if e.ItemStatus == nil {
+			f.add("payload", "is required")
+			break
+		}
+		f.required("payload.rid", e.ItemStatus.Rid)
+		if e.ItemStatus.Status == 0 {
+			f.add("payload.status", "is required")
+		}
+	default:
+		f.add("type", fmt.Sprintf("unknown event type %q", e.Type))
+	}
+	return f.err("invalid order event")
+}
@@ -0,0 +1,50 @@
+package request
+
+import (
+	"time"
+
+	"WB2/internal/models"
+)
+
+// ListOrdersQuery - DTO query-параметров для списка и выгрузки заказов
+type ListOrdersQuery struct {
+	CustomerID      string `query:"customer_id"`
+	TrackNumber     string `query:"track_number"`
+	DeliveryService string `query:"delivery_service"`
+	Phone           string `query:"phone"`
+	Email           string `query:"email"`
+	CreatedFrom     string `query:"created_from"`
+	CreatedTo       string `query:"created_to"`
+}
+
+// ToFilter проверяет параметры и преобразует их в models.OrderFilter
+func (q *ListOrdersQuery) ToFilter() (models.OrderFilter, error) {
+	f := models.OrderFilter{
+		CustomerID:      q.CustomerID,
+		TrackNumber:     q.TrackNumber,
+		DeliveryService: q.DeliveryService,
+		Phone:           q.Phone,
+		Email:           q.Email,
+	}
+	var errs fieldErrors
+	if q.CreatedFrom != "" {
+		t, err := time.Parse(time.RFC3339, q.CreatedFrom)
+		if err != nil {
+			errs.add("created_from", "must be RFC3339")
+		} else {
+			f.CreatedFrom = &t
+		}
+	}
+	if q.CreatedTo != "" {
+		t, err := time.Parse(time.RFC3339, q.CreatedTo)
+		if err != nil {
+			errs.add("created_to", "must be RFC3339")
+		} else {
+			f.CreatedTo = &t
+		}
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && !f.CreatedFrom.Before(*f.CreatedTo) {
+		errs.add("created_from", "must be before created_to")
+	}
+	return f, errs.err("invalid filter")
+}
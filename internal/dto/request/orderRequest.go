@@ -1,9 +1,10 @@
 package request
 
 import (
+	"WB2/internal/apperr"
 	"WB2/internal/models"
-	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,6 +12,7 @@ import (
 
 // CreateOrderRequest - DTO для создания заказа
 type CreateOrderRequest struct {
+	OrderUID          string                `json:"order_uid"`
 	TrackNumber       string                `json:"track_number" validate:"required"`
 	Entry             string                `json:"entry" validate:"required"`
 	Delivery          CreateDeliveryRequest `json:"delivery" validate:"required"`
@@ -23,8 +25,15 @@ type CreateOrderRequest struct {
 	ShardKey          string                `json:"shardkey"`
 	SmID              int                   `json:"sm_id"`
 	OofShard          string                `json:"oof_shard"`
+	DateCreated       *time.Time            `json:"date_created"`
 }
 
+// maxOrderUIDLen - максимальная длина order_uid, переданного клиентом
+const maxOrderUIDLen = 64
+
+// maxClockSkew - допустимое расхождение часов клиента при передаче date_created
+const maxClockSkew = 5 * time.Minute
+
 // CreateDeliveryRequest - DTO для данных доставки
 type CreateDeliveryRequest struct {
 	Name    string `json:"name" validate:"required"`
@@ -65,38 +74,62 @@ type CreateItemRequest struct {
 	Status      int    `json:"status" validate:"required"`
 }
 
-// Validate валидация CreateOrderRequest
+// Validate валидация CreateOrderRequest; возвращает apperr.ErrValidation со списком всех недопустимых полей
 func (req *CreateOrderRequest) Validate() error {
-	if req.TrackNumber == "" || req.Entry == "" || req.CustomerID == "" {
-		return errors.New("track_number, entry, customer_id are required")
-	}
-	if req.Delivery.Name == "" || req.Delivery.Phone == "" || req.Delivery.Zip == "" || req.Delivery.City == "" || req.Delivery.Address == "" {
-		return errors.New("delivery.name, phone, zip, city, address are required")
+	var f fieldErrors
+	if len(req.OrderUID) > maxOrderUIDLen || strings.TrimSpace(req.OrderUID) != req.OrderUID {
+		f.add("order_uid", fmt.Sprintf("must be at most %d characters without surrounding spaces", maxOrderUIDLen))
 	}
-	if req.Payment.Transaction == "" || req.Payment.Currency == "" || req.Payment.Provider == "" {
-		return errors.New("payment.transaction, currency, provider are required")
+	if req.DateCreated != nil && req.DateCreated.After(time.Now().Add(maxClockSkew)) {
+		f.add("date_created", "must not be in the future")
 	}
+	f.required("track_number", req.TrackNumber)
+	f.required("entry", req.Entry)
+	f.required("customer_id", req.CustomerID)
+	f.required("delivery.name", req.Delivery.Name)
+	f.required("delivery.phone", req.Delivery.Phone)
+	f.required("delivery.zip", req.Delivery.Zip)
+	f.required("delivery.city", req.Delivery.City)
+	f.required("delivery.address", req.Delivery.Address)
+	f.required("payment.transaction", req.Payment.Transaction)
+	f.required("payment.currency", req.Payment.Currency)
+	f.required("payment.provider", req.Payment.Provider)
 	if req.Payment.Amount < 1 {
-		return fmt.Errorf("payment.amount must be >= 1")
+		f.add("payment.amount", "must be >= 1")
 	}
 	if req.Payment.PaymentDt <= 0 {
-		return fmt.Errorf("payment.payment_dt must be > 0")
-	}
-	if req.Payment.DeliveryCost < 0 || req.Payment.GoodsTotal < 0 || req.Payment.CustomFee < 0 {
-		return fmt.Errorf("payment costs must be >= 0")
+		f.add("payment.payment_dt", "must be > 0")
 	}
+	f.nonNegative("payment.delivery_cost", req.Payment.DeliveryCost)
+	f.nonNegative("payment.goods_total", req.Payment.GoodsTotal)
+	f.nonNegative("payment.custom_fee", req.Payment.CustomFee)
 	if len(req.Items) == 0 {
-		return errors.New("items must contain at least 1 item")
+		f.add("items", "must contain at least 1 item")
 	}
 	for i, it := range req.Items {
-		if it.ChrtID == 0 || it.TrackNumber == "" || it.Price < 1 || it.Rid == "" || it.Name == "" || it.TotalPrice < 1 || it.NmID == 0 || it.Brand == "" || it.Status == 0 {
-			return fmt.Errorf("invalid item at index %d", i)
+		p := fmt.Sprintf("items[%d].", i)
+		if it.ChrtID == 0 {
+			f.add(p+"chrt_id", "is required")
+		}
+		f.required(p+"track_number", it.TrackNumber)
+		f.required(p+"rid", it.Rid)
+		f.required(p+"name", it.Name)
+		f.required(p+"brand", it.Brand)
+		if it.Price < 1 {
+			f.add(p+"price", "must be >= 1")
+		}
+		if it.TotalPrice < 1 {
+			f.add(p+"total_price", "must be >= 1")
 		}
-		if it.Sale < 0 {
-			return fmt.Errorf("item.sale must be >= 0 at index %d", i)
+		if it.NmID == 0 {
+			f.add(p+"nm_id", "is required")
+		}
+		f.nonNegative(p+"sale", it.Sale)
+		if it.Status == 0 {
+			f.add(p+"status", "is required")
 		}
 	}
-	return nil
+	return f.err("invalid order")
 }
 
 // UpdateOrderRequest - DTO для обновления заказа
@@ -159,37 +192,42 @@ type UpdateItemRequest struct {
 
 // Validate валидация UpdateOrderRequest (частичная)
 func (req *UpdateOrderRequest) Validate() error {
-	if req.OrderUID == "" {
-		return errors.New("order_uid is required")
-	}
+	var f fieldErrors
+	f.required("order_uid", req.OrderUID)
 	if req.Payment != nil {
-		if req.Payment.Amount != 0 && req.Payment.Amount < 1 {
-			return errors.New("payment.amount must be >= 1 if provided")
-		}
-		if req.Payment.DeliveryCost < 0 || req.Payment.GoodsTotal < 0 || req.Payment.CustomFee < 0 {
-			return errors.New("payment costs must be >= 0")
+		if req.Payment.Amount < 0 {
+			f.add("payment.amount", "must be >= 1 if provided")
 		}
+		f.nonNegative("payment.delivery_cost", req.Payment.DeliveryCost)
+		f.nonNegative("payment.goods_total", req.Payment.GoodsTotal)
+		f.nonNegative("payment.custom_fee", req.Payment.CustomFee)
 	}
-	if len(req.Items) > 0 {
-		for i, it := range req.Items {
-			if it.Price != 0 && it.Price < 1 {
-				return fmt.Errorf("item.price must be >= 1 at index %d", i)
-			}
-			if it.TotalPrice != 0 && it.TotalPrice < 1 {
-				return fmt.Errorf("item.total_price must be >= 1 at index %d", i)
-			}
-			if it.Sale < 0 {
-				return fmt.Errorf("item.sale must be >= 0 at index %d", i)
-			}
+	for i, it := range req.Items {
+		p := fmt.Sprintf("items[%d].", i)
+		if it.Price < 0 {
+			f.add(p+"price", "must be >= 1 if provided")
+		}
+		if it.TotalPrice < 0 {
+			f.add(p+"total_price", "must be >= 1 if provided")
 		}
+		f.nonNegative(p+"sale", it.Sale)
 	}
-	return nil
+	return f.err("invalid order update")
 }
 
-// ToOrderModel преобразует CreateOrderRequest в models.Order
+// ToOrderModel преобразует CreateOrderRequest в models.Order.
+// order_uid и date_created берутся из запроса, если клиент их передал, иначе генерируются
 func (req *CreateOrderRequest) ToOrderModel() *models.Order {
+	orderUID := req.OrderUID
+	if orderUID == "" {
+		orderUID = uuid.NewString()
+	}
+	dateCreated := time.Now()
+	if req.DateCreated != nil {
+		dateCreated = *req.DateCreated
+	}
 	order := &models.Order{
-		OrderUID:          uuid.NewString(),
+		OrderUID:          orderUID,
 		TrackNumber:       req.TrackNumber,
 		Entry:             req.Entry,
 		Locale:            req.Locale,
@@ -198,7 +236,7 @@ func (req *CreateOrderRequest) ToOrderModel() *models.Order {
 		DeliveryService:   req.DeliveryService,
 		ShardKey:          req.ShardKey,
 		SmID:              req.SmID,
-		DateCreated:       time.Now(),
+		DateCreated:       dateCreated,
 		OofShard:          req.OofShard,
 	}
 
@@ -241,7 +279,7 @@ func (req *CreateOrderRequest) ToOrderModel() *models.Order {
 			TotalPrice:  item.TotalPrice,
 			NmID:        item.NmID,
 			Brand:       item.Brand,
-			Status:      item.Status,
+			Status:      models.ItemStatus(item.Status),
 		}
 	}
 
@@ -354,7 +392,7 @@ func (req *UpdateOrderRequest) UpdateOrderModel(order *models.Order) {
 				TotalPrice:  item.TotalPrice,
 				NmID:        item.NmID,
 				Brand:       item.Brand,
-				Status:      item.Status,
+				Status:      models.ItemStatus(item.Status),
 			}
 			if item.ID != 0 {
 				order.Items[i].ID = item.ID
@@ -362,3 +400,21 @@ func (req *UpdateOrderRequest) UpdateOrderModel(order *models.Order) {
 		}
 	}
 }
+
+// TransitionOrderRequest - DTO для смены статуса заказа
+type TransitionOrderRequest struct {
+	Status string `json:"status" validate:"required"`
+	Reason string `json:"reason"`
+}
+
+// Validate проверяет, что целевой статус известен, и возвращает его
+func (req *TransitionOrderRequest) Validate() (models.OrderStatus, error) {
+	if req.Status == "" {
+		return "", apperr.Validation("invalid transition", apperr.FieldError{Field: "status", Message: "is required"})
+	}
+	st, err := models.ParseOrderStatus(req.Status)
+	if err != nil {
+		return "", apperr.Validation("invalid transition", apperr.FieldError{Field: "status", Message: err.Error()})
+	}
+	return st, nil
+}
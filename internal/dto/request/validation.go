@@ -0,0 +1,30 @@
+package request
+
+import "WB2/internal/apperr"
+
+// fieldErrors накапливает ошибки полей, чтобы клиент получил их все за один ответ
+type fieldErrors []apperr.FieldError
+
+func (f *fieldErrors) add(field, message string) {
+	*f = append(*f, apperr.FieldError{Field: field, Message: message})
+}
+
+func (f *fieldErrors) required(field, value string) {
+	if value == "" {
+		f.add(field, "is required")
+	}
+}
+
+func (f *fieldErrors) nonNegative(field string, value int) {
+	if value < 0 {
+		f.add(field, "must be >= 0")
+	}
+}
+
+// err возвращает apperr.ErrValidation с накопленными полями либо nil, если ошибок нет
+func (f fieldErrors) err(message string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	return apperr.Validation(message, f...)
+}
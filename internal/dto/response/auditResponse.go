@@ -0,0 +1,119 @@
+package response
+
+import (
+	"encoding/json"
+	"time"
+
+	"WB2/internal/models"
+	"WB2/internal/redact"
+)
+
+// AuditRecordResponse - DTO записи журнала изменений заказа
+type AuditRecordResponse struct {
+	ID        uint            `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityID  uint            `json:"entity_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Diff      json.RawMessage `json:"diff,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OrderHistoryResponse - DTO журнала изменений заказа
+type OrderHistoryResponse struct {
+	OrderUID string                `json:"order_uid"`
+	Records  []AuditRecordResponse `json:"records"`
+}
+
+// ToOrderHistoryResponse преобразует записи журнала в OrderHistoryResponse.
+// В снимках доставки персональные данные маскируются согласно level
+func ToOrderHistoryResponse(orderUID string, records []models.OrderAudit, level redact.Level) *OrderHistoryResponse {
+	resp := &OrderHistoryResponse{
+		OrderUID: orderUID,
+		Records:  make([]AuditRecordResponse, len(records)),
+	}
+	for i, r := range records {
+		resp.Records[i] = AuditRecordResponse{
+			ID:        r.ID,
+			Entity:    string(r.Entity),
+			EntityID:  r.EntityID,
+			Action:    string(r.Action),
+			Actor:     r.Actor,
+			Before:    rawJSON(r.Before),
+			After:     rawJSON(r.After),
+			Diff:      rawJSON(r.Diff),
+			CreatedAt: r.CreatedAt,
+		}
+		if r.Entity == models.AuditEntityDelivery && level != redact.None {
+			rec := &resp.Records[i]
+			rec.Before = redactSnapshot(rec.Before, level)
+			rec.After = redactSnapshot(rec.After, level)
+			rec.Diff = redactDiff(rec.Diff, level)
+		}
+	}
+	return resp
+}
+
+// redactSnapshot маскирует поля в снимке доставки вида {"phone": "..."}
+func redactSnapshot(raw json.RawMessage, level redact.Level) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	var snap map[string]any
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil
+	}
+	for field, v := range snap {
+		snap[field] = redact.AnyValue(field, v, level)
+	}
+	out, err := json.Marshal(snap)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// redactDiff маскирует поля в diff доставки вида {"phone": {"from": "...", "to": "..."}}
+func redactDiff(raw json.RawMessage, level redact.Level) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	var diff map[string]map[string]any
+	if err := json.Unmarshal(raw, &diff); err != nil {
+		return nil
+	}
+	for field, ch := range diff {
+		for side, v := range ch {
+			ch[side] = redact.AnyValue(field, v, level)
+		}
+	}
+	out, err := json.Marshal(diff)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// FieldChangeResponse - DTO изменения значения по пути в агрегате заказа
+type FieldChangeResponse struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// OrderDiffResponse - DTO различий состояния заказа между двумя моментами времени
+type OrderDiffResponse struct {
+	OrderUID string                `json:"order_uid"`
+	From     time.Time             `json:"from"`
+	To       time.Time             `json:"to"`
+	Changes  []FieldChangeResponse `json:"changes"`
+}
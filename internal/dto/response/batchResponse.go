@@ -0,0 +1,41 @@
+package response
+
+// Статусы обработки записи пакетного импорта
+const (
+	BatchStatusCreated   = "created"
+	BatchStatusDuplicate = "duplicate"
+	BatchStatusInvalid   = "invalid"
+	BatchStatusFailed    = "failed"
+)
+
+// BatchOrderResult - DTO результата по одной записи пакета
+type BatchOrderResult struct {
+	Index    int    `json:"index"`
+	Status   string `json:"status"`
+	OrderUID string `json:"order_uid,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchOrdersResponse - DTO ответа пакетного импорта со сводкой и результатами по записям
+type BatchOrdersResponse struct {
+	Total     int                `json:"total"`
+	Created   int                `json:"created"`
+	Duplicate int                `json:"duplicate"`
+	Invalid   int                `json:"invalid"`
+	Failed    int                `json:"failed"`
+	Results   []BatchOrderResult `json:"results"`
+}
+
+// Count учитывает результат записи в сводке
+func (r *BatchOrdersResponse) Count(status string) {
+	switch status {
+	case BatchStatusCreated:
+		r.Created++
+	case BatchStatusDuplicate:
+		r.Duplicate++
+	case BatchStatusInvalid:
+		r.Invalid++
+	case BatchStatusFailed:
+		r.Failed++
+	}
+}
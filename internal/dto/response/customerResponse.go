@@ -0,0 +1,45 @@
+package response
+
+import (
+	"time"
+
+	"WB2/internal/models"
+	"WB2/internal/redact"
+)
+
+// CustomerOrderExport - заказ в архиве данных клиента; DeletedAt задан для удалённых заказов
+type CustomerOrderExport struct {
+	OrderResponse
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CustomerDataExport - DTO архива всех данных клиента
+type CustomerDataExport struct {
+	CustomerID string                `json:"customer_id"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Orders     []CustomerOrderExport `json:"orders"`
+}
+
+// ToCustomerDataExport собирает архив данных клиента из его заказов
+func ToCustomerDataExport(customerID string, orders []models.Order, level redact.Level) *CustomerDataExport {
+	resp := &CustomerDataExport{
+		CustomerID: customerID,
+		ExportedAt: time.Now().UTC(),
+		Orders:     make([]CustomerOrderExport, len(orders)),
+	}
+	for i := range orders {
+		resp.Orders[i] = CustomerOrderExport{OrderResponse: *ToOrderResponse(&orders[i], level)}
+		if orders[i].DeletedAt.Valid {
+			deletedAt := orders[i].DeletedAt.Time
+			resp.Orders[i].DeletedAt = &deletedAt
+		}
+	}
+	return resp
+}
+
+// CustomerEraseResponse - DTO результата обезличивания данных клиента
+type CustomerEraseResponse struct {
+	CustomerID string   `json:"customer_id"`
+	Orders     []string `json:"orders"`
+	Count      int      `json:"count"`
+}
@@ -2,6 +2,7 @@ package response
 
 import (
 	"WB2/internal/models"
+	"WB2/internal/redact"
 	"time"
 )
 
@@ -9,6 +10,7 @@ import (
 type OrderResponse struct {
 	ID                uint             `json:"id"`
 	OrderUID          string           `json:"order_uid"`
+	Status            string           `json:"status"`
 	TrackNumber       string           `json:"track_number"`
 	Entry             string           `json:"entry"`
 	Delivery          DeliveryResponse `json:"delivery"`
@@ -38,6 +40,14 @@ type DeliveryResponse struct {
 	Email   string `json:"email"`
 }
 
+// Redact маскирует персональные данные получателя согласно level
+func (d *DeliveryResponse) Redact(level redact.Level) {
+	d.Name = redact.Value(redact.FieldName, d.Name, level)
+	d.Phone = redact.Value(redact.FieldPhone, d.Phone, level)
+	d.Email = redact.Value(redact.FieldEmail, d.Email, level)
+	d.Address = redact.Value(redact.FieldAddress, d.Address, level)
+}
+
 // PaymentResponse - DTO для ответа с данными платежа
 type PaymentResponse struct {
 	ID           uint   `json:"id"`
@@ -67,6 +77,7 @@ type ItemResponse struct {
 	NmID        int    `json:"nm_id"`
 	Brand       string `json:"brand"`
 	Status      int    `json:"status"`
+	StatusName  string `json:"status_name,omitempty"`
 }
 
 // GetAllOrdersResponse - DTO для ответа со списком заказов
@@ -75,13 +86,6 @@ type GetAllOrdersResponse struct {
 	Total  int             `json:"total"`
 }
 
-// ErrorResponse - DTO для ошибок
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-}
-
 // SuccessResponse - DTO для успешных операций
 type SuccessResponse struct {
 	Success bool        `json:"success"`
@@ -94,11 +98,12 @@ type DeleteOrderRequest struct {
 	OrderUID string `json:"order_uid" validate:"required"`
 }
 
-// ToOrderResponse преобразует models.Order в OrderResponse
-func ToOrderResponse(order *models.Order) *OrderResponse {
+// ToOrderResponse преобразует models.Order в OrderResponse, маскируя персональные данные доставки согласно level
+func ToOrderResponse(order *models.Order, level redact.Level) *OrderResponse {
 	response := &OrderResponse{
 		ID:                order.ID,
 		OrderUID:          order.OrderUID,
+		Status:            string(order.Status),
 		TrackNumber:       order.TrackNumber,
 		Entry:             order.Entry,
 		Locale:            order.Locale,
@@ -124,6 +129,7 @@ func ToOrderResponse(order *models.Order) *OrderResponse {
 		Region:  order.Delivery.Region,
 		Email:   order.Delivery.Email,
 	}
+	response.Delivery.Redact(level)
 
 	// Преобразуем платеж
 	response.Payment = PaymentResponse{
@@ -155,7 +161,8 @@ func ToOrderResponse(order *models.Order) *OrderResponse {
 			TotalPrice:  item.TotalPrice,
 			NmID:        item.NmID,
 			Brand:       item.Brand,
-			Status:      item.Status,
+			Status:      int(item.Status),
+			StatusName:  item.Status.Name(),
 		}
 	}
 
@@ -163,14 +170,14 @@ func ToOrderResponse(order *models.Order) *OrderResponse {
 }
 
 // ToOrderResponseList преобразует список models.Order в GetAllOrdersResponse
-func ToOrderResponseList(orders []models.Order, total, page, limit int) *GetAllOrdersResponse {
+func ToOrderResponseList(orders []models.Order, total, page, limit int, level redact.Level) *GetAllOrdersResponse {
 	response := &GetAllOrdersResponse{
 		Orders: make([]OrderResponse, len(orders)),
 		Total:  total,
 	}
 
 	for i, order := range orders {
-		response.Orders[i] = *ToOrderResponse(&order)
+		response.Orders[i] = *ToOrderResponse(&order, level)
 	}
 
 	return response
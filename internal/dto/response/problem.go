@@ -0,0 +1,18 @@
+package response
+
+import "WB2/internal/apperr"
+
+// ContentTypeProblem - MIME-тип ответа с ошибкой по RFC 7807
+const ContentTypeProblem = "application/problem+json"
+
+// Problem - DTO ошибки по RFC 7807. Code - машиночитаемый код ошибки,
+// Errors - ошибки отдельных полей запроса при валидации
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Code     string              `json:"code"`
+	Errors   []apperr.FieldError `json:"errors,omitempty"`
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"time"
+
+	"WB2/internal/models"
+)
+
+// StatusChangeResponse - DTO записи истории статусов
+type StatusChangeResponse struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderStatusResponse - DTO текущего статуса заказа, доступных переходов и истории
+type OrderStatusResponse struct {
+	OrderUID           string                 `json:"order_uid"`
+	Status             string                 `json:"status"`
+	AllowedTransitions []string               `json:"allowed_transitions"`
+	History            []StatusChangeResponse `json:"history"`
+}
+
+// ToOrderStatusResponse собирает OrderStatusResponse по заказу и его истории статусов
+func ToOrderStatusResponse(order *models.Order, history []models.OrderStatusHistory) *OrderStatusResponse {
+	resp := &OrderStatusResponse{
+		OrderUID:           order.OrderUID,
+		Status:             string(order.Status),
+		AllowedTransitions: make([]string, 0, len(order.Status.AllowedTransitions())),
+		History:            make([]StatusChangeResponse, len(history)),
+	}
+	for _, st := range order.Status.AllowedTransitions() {
+		resp.AllowedTransitions = append(resp.AllowedTransitions, string(st))
+	}
+	for i, h := range history {
+		resp.History[i] = StatusChangeResponse{
+			From:      string(h.FromStatus),
+			To:        string(h.ToStatus),
+			Reason:    h.Reason,
+			CreatedAt: h.CreatedAt,
+		}
+	}
+	return resp
+}
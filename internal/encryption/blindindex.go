@@ -0,0 +1,39 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// BlindIndex - детерминированный HMAC-SHA256 нормализованного значения для поиска по зашифрованной колонке.
+// Без настроенного набора ключей HMAC считается на пустом ключе: поиск работает, но защиты от подбора нет
+func BlindIndex(value string) string {
+	if value == "" {
+		return ""
+	}
+	var key []byte
+	if k := CurrentKeyring(); k != nil {
+		key = k.blindIndex
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NormalizePhone оставляет в номере только цифры, чтобы "+7 (900) 123-45-67" и "79001234567" совпадали
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// NormalizeEmail приводит адрес к нижнему регистру без пробелов по краям
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
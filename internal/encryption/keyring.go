@@ -0,0 +1,212 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// prefix - признак зашифрованного значения; значения без него считаются открытым текстом (строки до включения шифрования)
+const prefix = "enc:v1:"
+
+// keySize - размер ключей: AES-256
+const keySize = 32
+
+var (
+	ErrUnknownKey = errors.New("encryption: unknown key id")
+	ErrNoKeyring  = errors.New("encryption: keyring is not configured")
+	ErrMalformed  = errors.New("encryption: malformed ciphertext")
+)
+
+// Keyfile - формат файла ключей (JSON). Ключи - base64 от 32 байт.
+// Старые ключи остаются в keys, пока все строки не перешифрованы под active_key_id
+type Keyfile struct {
+	ActiveKeyID   string            `json:"active_key_id"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blind_index_key"`
+}
+
+// Keyring - набор ключей шифрования ключей (KEK) с идентификаторами и ключ blind index
+type Keyring struct {
+	activeID   string
+	keks       map[string]cipher.AEAD
+	blindIndex []byte
+}
+
+// LoadKeyfile читает и проверяет файл ключей
+func LoadKeyfile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: read keyfile: %w", err)
+	}
+	var kf Keyfile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("encryption: parse keyfile: %w", err)
+	}
+	return NewKeyring(kf)
+}
+
+// NewKeyring создаёт Keyring из содержимого файла ключей
+func NewKeyring(kf Keyfile) (*Keyring, error) {
+	if _, ok := kf.Keys[kf.ActiveKeyID]; !ok {
+		return nil, fmt.Errorf("encryption: active key %q is not in keys", kf.ActiveKeyID)
+	}
+	k := &Keyring{activeID: kf.ActiveKeyID, keks: make(map[string]cipher.AEAD, len(kf.Keys))}
+	for id, encoded := range kf.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("encryption: invalid key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %q: %w", id, err)
+		}
+		if k.keks[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if k.blindIndex, err = decodeKey(kf.BlindIndexKey); err != nil {
+		return nil, fmt.Errorf("encryption: blind_index_key: %w", err)
+	}
+	return k, nil
+}
+
+// ActiveKeyID - ключ, под которым шифруются новые значения
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt шифрует значение конвертом: данные - случайным ключом (DEK), DEK - активным KEK.
+// Формат: enc:v1:<key id>:<base64 зашифрованного DEK>:<base64 зашифрованных данных>
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keks[k.activeID], dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAEAD, plaintext)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return prefix + k.activeID + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение, зашифрованное любым из ключей набора
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	id, parts, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	kek, ok := k.keks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	sealed, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	dek, err := open(kek, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: unwrap data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(dataAEAD, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted сообщает, что значение хранится в зашифрованном виде
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID возвращает идентификатор ключа зашифрованного значения
+func KeyID(value string) (string, error) {
+	id, _, err := parse(value)
+	return id, err
+}
+
+func parse(value string) (string, []string, error) {
+	if !IsEncrypted(value) {
+		return "", nil, ErrMalformed
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, ErrMalformed
+	}
+	return parts[0], parts, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрует данные AES-GCM со случайным nonce, nonce кладётся перед шифртекстом
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// active - набор ключей процесса; его использует GORM-сериализатор и blind index
+var active atomic.Pointer[Keyring]
+
+// SetKeyring задаёт набор ключей процесса; nil выключает шифрование новых значений
+func SetKeyring(k *Keyring) {
+	active.Store(k)
+}
+
+// CurrentKeyring возвращает набор ключей процесса или nil
+func CurrentKeyring() *Keyring {
+	return active.Load()
+}
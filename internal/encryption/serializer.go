@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName - имя сериализатора для тегов моделей: `gorm:"serializer:encrypted"`
+const SerializerName = "encrypted"
+
+func init() {
+	schema.RegisterSerializer(SerializerName, Serializer{})
+}
+
+// Serializer шифрует string и []byte поля при записи и расшифровывает при чтении.
+// Без набора ключей значения пишутся как есть; открытые значения (записанные до включения шифрования) читаются как есть
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("encryption: unsupported db value %T for %s", dbValue, field.Name)
+	}
+
+	plaintext := []byte(stored)
+	if IsEncrypted(stored) {
+		k := CurrentKeyring()
+		if k == nil {
+			return fmt.Errorf("%w: cannot decrypt %s", ErrNoKeyring, field.Name)
+		}
+		var err error
+		if plaintext, err = k.Decrypt(stored); err != nil {
+			return fmt.Errorf("%s: %w", field.Name, err)
+		}
+	}
+
+	var value reflect.Value
+	switch field.FieldType.Kind() {
+	case reflect.String:
+		value = reflect.ValueOf(string(plaintext))
+	case reflect.Slice:
+		value = reflect.ValueOf(plaintext)
+	default:
+		return fmt.Errorf("encryption: unsupported field type %s for %s", field.FieldType, field.Name)
+	}
+	field.ReflectValueOf(ctx, dst).Set(value.Convert(field.FieldType))
+	return nil
+}
+
+func (Serializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue any) (any, error) {
+	rv := reflect.ValueOf(fieldValue)
+	var plaintext []byte
+	switch rv.Kind() {
+	case reflect.String:
+		plaintext = []byte(rv.String())
+	case reflect.Slice:
+		plaintext = rv.Bytes()
+	default:
+		return nil, fmt.Errorf("encryption: unsupported field type %T for %s", fieldValue, field.Name)
+	}
+
+	k := CurrentKeyring()
+	if k == nil || len(plaintext) == 0 {
+		return fieldValue, nil
+	}
+	encrypted, err := k.Encrypt(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field.Name, err)
+	}
+	// bytea-колонки получают []byte, текстовые - строку
+	if rv.Kind() == reflect.Slice {
+		return []byte(encrypted), nil
+	}
+	return encrypted, nil
+}
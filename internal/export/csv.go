@@ -0,0 +1,60 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"WB2/internal/models"
+)
+
+var csvHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city", "delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider", "payment_amount", "payment_dt", "payment_bank",
+	"payment_delivery_cost", "payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name", "item_sale", "item_size", "item_total_price",
+	"item_nm_id", "item_brand", "item_status",
+}
+
+// csvWriter пишет плоские строки с заголовком в первой строке
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw}, nil
+}
+
+func (w *csvWriter) Write(order *models.Order) error {
+	for _, r := range FlattenOrder(order) {
+		if err := w.w.Write(r.csvRecord()); err != nil {
+			return err
+		}
+	}
+	// сбрасываем буфер после каждого заказа, чтобы клиент получал данные потоком
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (r Row) csvRecord() []string {
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+	return []string{
+		r.OrderUID, r.TrackNumber, r.Entry, r.Locale, r.CustomerID, r.DeliveryService, r.ShardKey, i(r.SmID), r.DateCreated.Format(time.RFC3339), r.OofShard,
+		r.DeliveryName, r.DeliveryPhone, r.DeliveryZip, r.DeliveryCity, r.DeliveryAddress, r.DeliveryRegion, r.DeliveryEmail,
+		r.PaymentTransaction, r.PaymentRequestID, r.PaymentCurrency, r.PaymentProvider, i(r.PaymentAmount), i(r.PaymentDt), r.PaymentBank,
+		i(r.PaymentDeliveryCost), i(r.PaymentGoodsTotal), i(r.PaymentCustomFee),
+		i(r.ItemChrtID), r.ItemTrackNumber, i(r.ItemPrice), r.ItemRid, r.ItemName, i(r.ItemSale), r.ItemSize, i(r.ItemTotalPrice),
+		i(r.ItemNmID), r.ItemBrand, i(r.ItemStatus),
+	}
+}
@@ -0,0 +1,156 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"WB2/internal/models"
+)
+
+// Format - формат выгрузки заказов
+type Format string
+
+const (
+	FormatNDJSON  Format = "ndjson"
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat проверяет название формата; пустая строка означает NDJSON
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatCSV, FormatParquet:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unsupported export format %q (want ndjson, csv or parquet)", s)
+}
+
+// ContentType возвращает MIME-тип для формата
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// Writer последовательно пишет заказы в выходной поток
+type Writer interface {
+	// Write записывает один заказ (для плоских форматов - по строке на товар)
+	Write(order *models.Order) error
+	// Close дописывает буферизованные данные и служебные блоки формата
+	Close() error
+}
+
+// NewWriter создаёт Writer для указанного формата
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatParquet:
+		return newParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// Row - плоское представление заказа: одна строка на товар с полями заказа, доставки и платежа
+type Row struct {
+	OrderUID            string    `parquet:"order_uid"`
+	TrackNumber         string    `parquet:"track_number"`
+	Entry               string    `parquet:"entry"`
+	Locale              string    `parquet:"locale"`
+	CustomerID          string    `parquet:"customer_id"`
+	DeliveryService     string    `parquet:"delivery_service"`
+	ShardKey            string    `parquet:"shardkey"`
+	SmID                int64     `parquet:"sm_id"`
+	DateCreated         time.Time `parquet:"date_created,timestamp(millisecond)"`
+	OofShard            string    `parquet:"oof_shard"`
+	DeliveryName        string    `parquet:"delivery_name"`
+	DeliveryPhone       string    `parquet:"delivery_phone"`
+	DeliveryZip         string    `parquet:"delivery_zip"`
+	DeliveryCity        string    `parquet:"delivery_city"`
+	DeliveryAddress     string    `parquet:"delivery_address"`
+	DeliveryRegion      string    `parquet:"delivery_region"`
+	DeliveryEmail       string    `parquet:"delivery_email"`
+	PaymentTransaction  string    `parquet:"payment_transaction"`
+	PaymentRequestID    string    `parquet:"payment_request_id"`
+	PaymentCurrency     string    `parquet:"payment_currency"`
+	PaymentProvider     string    `parquet:"payment_provider"`
+	PaymentAmount       int64     `parquet:"payment_amount"`
+	PaymentDt           int64     `parquet:"payment_dt"`
+	PaymentBank         string    `parquet:"payment_bank"`
+	PaymentDeliveryCost int64     `parquet:"payment_delivery_cost"`
+	PaymentGoodsTotal   int64     `parquet:"payment_goods_total"`
+	PaymentCustomFee    int64     `parquet:"payment_custom_fee"`
+	ItemChrtID          int64     `parquet:"item_chrt_id"`
+	ItemTrackNumber     string    `parquet:"item_track_number"`
+	ItemPrice           int64     `parquet:"item_price"`
+	ItemRid             string    `parquet:"item_rid"`
+	ItemName            string    `parquet:"item_name"`
+	ItemSale            int64     `parquet:"item_sale"`
+	ItemSize            string    `parquet:"item_size"`
+	ItemTotalPrice      int64     `parquet:"item_total_price"`
+	ItemNmID            int64     `parquet:"item_nm_id"`
+	ItemBrand           string    `parquet:"item_brand"`
+	ItemStatus          int64     `parquet:"item_status"`
+}
+
+// FlattenOrder разворачивает заказ в строки по товарам; заказ без товаров даёт одну строку
+func FlattenOrder(order *models.Order) []Row {
+	base := Row{
+		OrderUID:            order.OrderUID,
+		TrackNumber:         order.TrackNumber,
+		Entry:               order.Entry,
+		Locale:              order.Locale,
+		CustomerID:          order.CustomerID,
+		DeliveryService:     order.DeliveryService,
+		ShardKey:            order.ShardKey,
+		SmID:                int64(order.SmID),
+		DateCreated:         order.DateCreated,
+		OofShard:            order.OofShard,
+		DeliveryName:        order.Delivery.Name,
+		DeliveryPhone:       order.Delivery.Phone,
+		DeliveryZip:         order.Delivery.Zip,
+		DeliveryCity:        order.Delivery.City,
+		DeliveryAddress:     order.Delivery.Address,
+		DeliveryRegion:      order.Delivery.Region,
+		DeliveryEmail:       order.Delivery.Email,
+		PaymentTransaction:  order.Payment.Transaction,
+		PaymentRequestID:    order.Payment.RequestID,
+		PaymentCurrency:     order.Payment.Currency,
+		PaymentProvider:     order.Payment.Provider,
+		PaymentAmount:       int64(order.Payment.Amount),
+		PaymentDt:           order.Payment.PaymentDt,
+		PaymentBank:         order.Payment.Bank,
+		PaymentDeliveryCost: int64(order.Payment.DeliveryCost),
+		PaymentGoodsTotal:   int64(order.Payment.GoodsTotal),
+		PaymentCustomFee:    int64(order.Payment.CustomFee),
+	}
+	if len(order.Items) == 0 {
+		return []Row{base}
+	}
+	rows := make([]Row, len(order.Items))
+	for i, it := range order.Items {
+		row := base
+		row.ItemChrtID = int64(it.ChrtID)
+		row.ItemTrackNumber = it.TrackNumber
+		row.ItemPrice = int64(it.Price)
+		row.ItemRid = it.Rid
+		row.ItemName = it.Name
+		row.ItemSale = int64(it.Sale)
+		row.ItemSize = it.Size
+		row.ItemTotalPrice = int64(it.TotalPrice)
+		row.ItemNmID = int64(it.NmID)
+		row.ItemBrand = it.Brand
+		row.ItemStatus = int64(it.Status)
+		rows[i] = row
+	}
+	return rows
+}
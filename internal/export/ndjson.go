@@ -0,0 +1,26 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+
+	"WB2/internal/dto/response"
+	"WB2/internal/models"
+	"WB2/internal/redact"
+)
+
+// ndjsonWriter пишет по одному OrderResponse (со вложенными сущностями) на строку
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *ndjsonWriter) Write(order *models.Order) error {
+	// персональные данные маскирует вызывающий код до записи (см. redact.Delivery)
+	return w.enc.Encode(response.ToOrderResponse(order, redact.None))
+}
+
+func (w *ndjsonWriter) Close() error { return nil }
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"io"
+
+	"WB2/internal/models"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// rowGroupSize - число строк в row group; ограничивает объём буфера в памяти
+const rowGroupSize = 10000
+
+// parquetWriter пишет плоские строки в Parquet, сбрасывая row group по достижении rowGroupSize
+type parquetWriter struct {
+	w       *parquet.GenericWriter[Row]
+	pending int
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: parquet.NewGenericWriter[Row](w)}
+}
+
+func (w *parquetWriter) Write(order *models.Order) error {
+	rows := FlattenOrder(order)
+	if _, err := w.w.Write(rows); err != nil {
+		return err
+	}
+	w.pending += len(rows)
+	if w.pending >= rowGroupSize {
+		w.pending = 0
+		return w.w.Flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	return w.w.Close()
+}
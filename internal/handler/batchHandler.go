@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"WB2/internal/apperr"
+	"WB2/internal/dto/request"
+	"WB2/internal/dto/response"
+	"WB2/internal/lib/logger"
+	"WB2/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchRecords - максимальное число заказов в одном запросе пакетного импорта
+const maxBatchRecords = 10000
+
+// CreateOrdersBatch импортирует пакет заказов (JSON-массив или NDJSON) и возвращает результат по каждой записи
+func (h *Handler) CreateOrdersBatch(c echo.Context) error {
+	entries, err := request.DecodeOrderBatch(c.Request().Body, maxBatchRecords)
+	if err != nil {
+		if errors.Is(err, request.ErrBatchTooLarge) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return apperr.BadRequest("bad_request", err.Error())
+	}
+
+	resp := &response.BatchOrdersResponse{
+		Total:   len(entries),
+		Results: make([]response.BatchOrderResult, len(entries)),
+	}
+
+	// Записи, которые не удалось разобрать, в сервис не попадают; index связывает запрос с записью пакета
+	reqs := make([]*request.CreateOrderRequest, 0, len(entries))
+	index := make([]int, 0, len(entries))
+	for i, e := range entries {
+		resp.Results[i].Index = i
+		if e.Err != nil {
+			resp.Results[i].Status = response.BatchStatusInvalid
+			resp.Results[i].Error = e.Err.Error()
+			continue
+		}
+		reqs = append(reqs, e.Request)
+		index = append(index, i)
+	}
+
+	results, err := h.orders.ImportOrders(c.Request().Context(), reqs)
+	if err != nil {
+		return err
+	}
+	for j, r := range results {
+		h.batchResult(&resp.Results[index[j]], r)
+	}
+
+	for _, r := range resp.Results {
+		resp.Count(r.Status)
+	}
+	h.log.Info("batch imported", slog.Int("total", resp.Total), slog.Int("created", resp.Created),
+		slog.Int("duplicate", resp.Duplicate), slog.Int("invalid", resp.Invalid), slog.Int("failed", resp.Failed))
+
+	code := http.StatusOK
+	if resp.Created > 0 {
+		code = http.StatusCreated
+	}
+	return c.JSON(code, resp)
+}
+
+// batchResult переводит итог импорта записи в статус ответа. Причина отказа хранилища клиенту не отдаётся
+func (h *Handler) batchResult(res *response.BatchOrderResult, r service.ImportResult) {
+	var appErr *apperr.Error
+	switch {
+	case r.Err == nil:
+		res.Status = response.BatchStatusCreated
+		res.OrderUID = r.OrderUID
+	case errors.Is(r.Err, apperr.ErrValidation):
+		res.Status = response.BatchStatusInvalid
+		res.Error = r.Err.Error()
+	case errors.Is(r.Err, apperr.ErrConflict) && errors.As(r.Err, &appErr):
+		res.Status = response.BatchStatusDuplicate
+		res.OrderUID = r.OrderUID
+		res.Error = appErr.Message
+	default:
+		h.log.Error("batch record failed", slog.Int("index", res.Index), logger.Err(r.Err))
+		res.Status = response.BatchStatusFailed
+		res.Error = "failed to save order"
+	}
+}
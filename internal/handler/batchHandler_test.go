@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"WB2/internal/cache"
+	"WB2/internal/dto/request"
+	"WB2/internal/dto/response"
+	"WB2/internal/service"
+	"WB2/internal/service/servicetest"
+	storage "WB2/internal/storage/postgres"
+
+	"github.com/labstack/echo/v4"
+)
+
+func batchOrder(uid, transaction string) *request.CreateOrderRequest {
+	req := servicetest.NewCreateOrderRequest(uid)
+	req.Payment.Transaction = transaction
+	return req
+}
+
+// Ошибка одной записи порции не должна валить соседние. Дубликат определяется только по order_uid:
+// общий идентификатор платежа, как и в POST /order, дубликатом не считается
+func TestCreateOrdersBatchIsolatesFailedRecord(t *testing.T) {
+	db, err := storage.NewSQLiteStorage(":memory:", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Вставка заказа "broken" падает на уровне БД, хотя запись валидна
+	if err := db.Db.Exec("CREATE TRIGGER reject_broken BEFORE INSERT ON orders WHEN NEW.order_uid = 'broken' " +
+		"BEGIN SELECT RAISE(ABORT, 'rejected'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+	c := cache.NewOrderCache(time.Minute)
+	h := NewHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), service.NewOrderService(db, c))
+
+	body, _ := json.Marshal([]*request.CreateOrderRequest{
+		batchOrder("first", "tx-1"),
+		batchOrder("broken", "tx-2"),
+		batchOrder("second", "tx-2"),
+		batchOrder("first", "tx-3"),
+		batchOrder("third", "tx-1"),
+	})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders/batch", strings.NewReader(string(body)))
+	if err := h.CreateOrdersBatch(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	var resp response.BatchOrdersResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		response.BatchStatusCreated,
+		response.BatchStatusFailed,
+		response.BatchStatusCreated,
+		response.BatchStatusDuplicate,
+		response.BatchStatusCreated,
+	}
+	for i, r := range resp.Results {
+		if r.Status != want[i] {
+			t.Errorf("record %d: status %q, want %q (%s)", i, r.Status, want[i], r.Error)
+		}
+	}
+	for _, uid := range []string{"first", "second", "third"} {
+		if _, err := db.GetOrder(t.Context(), uid); err != nil {
+			t.Errorf("order %s not saved: %v", uid, err)
+		}
+	}
+}
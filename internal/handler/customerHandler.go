@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+
+	"WB2/internal/dto/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportCustomerData отдаёт JSON-архив всех заказов клиента (включая удалённые) с данными доставки
+func (h *Handler) ExportCustomerData(c echo.Context) error {
+	customerID := c.Param("id")
+	orders, err := h.orders.GetCustomerOrders(c.Request().Context(), customerID)
+	if err != nil {
+		return err
+	}
+	// customer_id приходит из URL: FormatMediaType экранирует его, чтобы он не вышел за пределы параметра
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		mime.FormatMediaType("attachment", map[string]string{"filename": "customer-" + customerID + ".json"}))
+	return c.JSON(http.StatusOK, response.ToCustomerDataExport(customerID, orders, piiLevel(c.Request().Context())))
+}
+
+// EraseCustomerData обезличивает данные получателя во всех заказах клиента
+func (h *Handler) EraseCustomerData(c echo.Context) error {
+	customerID := c.Param("id")
+	uids, err := h.orders.EraseCustomer(c.Request().Context(), customerID)
+	if err != nil {
+		return err
+	}
+	h.log.Info("customer data erased", "customer_id", customerID, "orders", len(uids))
+	return c.JSON(http.StatusOK, response.CustomerEraseResponse{
+		CustomerID: customerID,
+		Orders:     uids,
+		Count:      len(uids)})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"WB2/internal/cache"
+	"WB2/internal/models"
+	"WB2/internal/service"
+	storage "WB2/internal/storage/postgres"
+
+	"github.com/labstack/echo/v4"
+)
+
+// customer_id из URL не должен выходить за пределы параметра filename в Content-Disposition
+func TestExportCustomerDataEscapesFilename(t *testing.T) {
+	db, err := storage.NewSQLiteStorage(":memory:", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	customerID := `evil"; filename="x.exe`
+	order := &models.Order{OrderUID: "order-1", CustomerID: customerID, Delivery: models.Delivery{Name: "Test Testov"},
+		Payment: models.Payment{Transaction: "tx-1"}}
+	if _, err := db.CreateOrder(t.Context(), order); err != nil {
+		t.Fatal(err)
+	}
+	c := cache.NewOrderCache(time.Minute)
+	h := NewHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), service.NewOrderService(db, c))
+
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/customer/x/export", nil), rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(customerID)
+	if err := h.ExportCustomerData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	disposition, params, err := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentDisposition))
+	if err != nil {
+		t.Fatalf("Content-Disposition %q: %v", rec.Header().Get(echo.HeaderContentDisposition), err)
+	}
+	if disposition != "attachment" || params["filename"] != "customer-"+customerID+".json" || len(params) != 1 {
+		t.Errorf("Content-Disposition parsed as %q %v", disposition, params)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/dto/request"
+	"WB2/internal/export"
+	"WB2/internal/lib/logger"
+	"WB2/internal/models"
+	"WB2/internal/redact"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportBatchSize - сколько заказов читается из БД за один проход курсора
+const exportBatchSize = 500
+
+// ExportOrders потоково выгружает заказы (ndjson, csv или parquet) с теми же фильтрами, что и список
+func (h *Handler) ExportOrders(c echo.Context) error {
+	var q request.ListOrdersQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return bindError(err)
+	}
+	filter, err := q.ToFilter()
+	if err != nil {
+		return err
+	}
+	format, err := export.ParseFormat(c.QueryParam("format"))
+	if err != nil {
+		return apperr.Validation("invalid query", apperr.FieldError{Field: "format", Message: err.Error()})
+	}
+
+	res := c.Response()
+	// Выгрузка может идти дольше общего WriteTimeout сервера - снимаем дедлайн для этого ответа
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		h.log.Warn("export: cannot reset write deadline", logger.Err(err))
+	}
+	res.Header().Set(echo.HeaderContentType, format.ContentType())
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"orders.%s\"", format))
+	res.WriteHeader(http.StatusOK)
+
+	w, err := export.NewWriter(format, res)
+	if err != nil {
+		h.log.Error("export: init writer", logger.Err(err))
+		return nil
+	}
+
+	ctx := c.Request().Context()
+	level := piiLevel(ctx)
+	exported := 0
+	err = h.orders.StreamOrders(ctx, filter, exportBatchSize, func(batch []models.Order) error {
+		for i := range batch {
+			// заказы прочитаны из БД только для выгрузки, поэтому маскируем прямо в них
+			redact.Delivery(&batch[i].Delivery, level)
+			if err := w.Write(&batch[i]); err != nil {
+				return err
+			}
+		}
+		exported += len(batch)
+		res.Flush()
+		return nil
+	})
+	// Заголовки уже отправлены, поэтому об ошибке можно только сообщить в лог и оборвать поток
+	if err != nil {
+		h.log.Error("export failed", slog.String("format", string(format)), slog.Int("exported", exported), logger.Err(err))
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		h.log.Error("export: close writer", logger.Err(err))
+		return nil
+	}
+	h.log.Info("export finished", slog.String("format", string(format)), slog.Int("orders", exported))
+	return nil
+}
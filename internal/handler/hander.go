@@ -1,23 +1,48 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 
-	"WB2/internal/cache"
-	storage "WB2/internal/storage/postgres"
+	"WB2/internal/apperr"
+	"WB2/internal/auth"
+	"WB2/internal/redact"
+	"WB2/internal/service"
+
+	"github.com/labstack/echo/v4"
 )
 
 // Handler реализует обработчики HTTP-запросов и доступ к зависимостям
 type Handler struct {
-	log     *slog.Logger
-	storage *storage.Storage
-	cache   *cache.OrderCache
+	log *slog.Logger
+	// orders - все операции над заказами: хранилище и кэш обработчики видят только через сервис
+	orders *service.OrderService
 }
 
-func NewHandler(log *slog.Logger, storage *storage.Storage, cache *cache.OrderCache) *Handler {
+func NewHandler(log *slog.Logger, orders *service.OrderService) *Handler {
 	return &Handler{
-		log:     log,
-		storage: storage,
-		cache:   cache,
+		log:    log,
+		orders: orders,
+	}
+}
+
+// piiLevel - степень маскирования персональных данных для клиента запроса; без клиента данные маскируются полностью
+func piiLevel(ctx context.Context) redact.Level {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return redact.Full
+	}
+	return redact.LevelFor(p.Role)
+}
+
+// bindError - тело или параметры запроса не удалось разобрать
+func bindError(err error) error {
+	msg := err.Error()
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		msg = fmt.Sprint(he.Message)
 	}
+	return apperr.BadRequest("bad_request", msg).WithCause(err)
 }
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/audit"
+	"WB2/internal/dto/response"
+	"WB2/internal/redact"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetOrderHistory возвращает журнал изменений заказа (в том числе удалённого)
+func (h *Handler) GetOrderHistory(c echo.Context) error {
+	orderUID := c.Param("id")
+	records, err := h.orders.GetOrderHistory(c.Request().Context(), orderUID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.ToOrderHistoryResponse(orderUID, records, piiLevel(c.Request().Context())))
+}
+
+// getOrderAsOf возвращает состояние заказа на момент asOf, восстановленное по журналу изменений
+func (h *Handler) getOrderAsOf(c echo.Context, orderUID, asOf string) error {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return apperr.Validation("invalid query", apperr.FieldError{Field: "as_of", Message: "must be RFC3339"})
+	}
+	order, err := h.orders.GetOrderAt(c.Request().Context(), orderUID, at)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return apperr.NotFound("order_not_found", "order did not exist at "+at.Format(time.RFC3339))
+	}
+	order.Delivery.Redact(piiLevel(c.Request().Context()))
+	return c.JSON(http.StatusOK, order)
+}
+
+// GetOrderDiff возвращает различия состояния заказа между моментами from и to (RFC3339; to по умолчанию - сейчас)
+func (h *Handler) GetOrderDiff(c echo.Context) error {
+	orderUID := c.Param("id")
+	from, err := time.Parse(time.RFC3339, c.QueryParam("from"))
+	if err != nil {
+		return apperr.Validation("invalid query", apperr.FieldError{Field: "from", Message: "is required and must be RFC3339"})
+	}
+	to := time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return apperr.Validation("invalid query", apperr.FieldError{Field: "to", Message: "must be RFC3339"})
+		}
+	}
+	if to.Before(from) {
+		return apperr.Validation("invalid query", apperr.FieldError{Field: "from", Message: "must not be after to"})
+	}
+
+	ctx := c.Request().Context()
+	before, err := h.orders.GetOrderAt(ctx, orderUID, from)
+	if err != nil {
+		return err
+	}
+	after, err := h.orders.GetOrderAt(ctx, orderUID, to)
+	if err != nil {
+		return err
+	}
+	if before == nil && after == nil {
+		return apperr.NotFound("order_not_found", "order did not exist in the requested interval")
+	}
+
+	changes, err := audit.DiffOrders(before, after)
+	if err != nil {
+		return apperr.FromStorage(err, nil, nil)
+	}
+	resp := response.OrderDiffResponse{
+		OrderUID: orderUID,
+		From:     from,
+		To:       to,
+		Changes:  make([]response.FieldChangeResponse, len(changes)),
+	}
+	level := piiLevel(ctx)
+	for i, ch := range changes {
+		from, to := ch.From, ch.To
+		if field, ok := strings.CutPrefix(ch.Path, "delivery."); ok && level != redact.None {
+			from, to = redact.AnyValue(field, from, level), redact.AnyValue(field, to, level)
+		}
+		resp.Changes[i] = response.FieldChangeResponse{Path: ch.Path, From: from, To: to}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
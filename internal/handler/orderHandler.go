@@ -2,11 +2,9 @@ package handler
 
 import (
 	"net/http"
-	"time"
 
 	"WB2/internal/dto/request"
 	"WB2/internal/dto/response"
-	"WB2/internal/models"
 
 	"github.com/labstack/echo/v4"
 )
@@ -15,180 +13,80 @@ import (
 func (h *Handler) CreateOrder(c echo.Context) error {
 	var req request.CreateOrderRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Error:   "bind_error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest})
+		return bindError(err)
 	}
-	// validate request
-	if err := req.Validate(); err != nil {
-		return c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Error:   "validation_error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
-	}
-
-	order := req.ToOrderModel()
-	if err := h.storage.Db.Create(order).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Error:   "create_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError})
+	order, err := h.orders.CreateOrder(c.Request().Context(), &req)
+	if err != nil {
+		return err
 	}
 
-	h.cache.Set(order)
-
 	return c.JSON(http.StatusCreated, response.SuccessResponse{
 		Success: true,
 		Message: "order created",
-		Data:    response.ToOrderResponse(order)})
+		Data:    response.ToOrderResponse(order, piiLevel(c.Request().Context()))})
 }
 
-// GetAllOrdres возвращает список заказов, предпочитая кэш, с фолбеком в БД
+// GetAllOrdres возвращает список заказов, предпочитая кэш, с фолбеком в БД.
+// При заданных фильтрах выборка всегда идёт из БД: кэш может содержать не все заказы
 func (h *Handler) GetAllOrdres(c echo.Context) error {
-	start := time.Now()
-	// Фолбек в БД
-	// Сначала пробуем из кэша; если он пуст, читаем из БД и наполняем кэш
-	cached := h.cache.GetAll()
-	duration := time.Since(start)
-	h.log.Info("cache_get_all_timing", "duration_ms", duration.Milliseconds())
-	if len(cached) == 0 {
-		var orders []models.Order
-		if err := h.storage.Db.Preload("Delivery").Preload("Payment").Preload("Items").Find(&orders).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-				Error:   "list_error",
-				Message: err.Error(),
-				Code:    http.StatusInternalServerError})
-		}
-		for i := range orders {
-			o := orders[i]
-			h.cache.Set(&o)
-		}
-		cached = h.cache.GetAll()
+	var q request.ListOrdersQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return bindError(err)
 	}
-	// Преобразуем для ответа
-	orders := make([]models.Order, len(cached))
-	for i := range cached {
-		orders[i] = *cached[i]
+	filter, err := q.ToFilter()
+	if err != nil {
+		return err
 	}
-	resp := response.ToOrderResponseList(orders, len(orders), 1, len(orders))
-	return c.JSON(http.StatusOK, resp)
+	orders, err := h.orders.ListOrders(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.ToOrderResponseList(orders, len(orders), 1, len(orders), piiLevel(c.Request().Context())))
 }
 
-// GetOrderByID возвращает заказ по UID из кэша либо БД
+// GetOrderByID возвращает заказ по UID из кэша либо БД.
+// С параметром as_of возвращает состояние заказа на указанный момент, восстановленное по журналу изменений
 func (h *Handler) GetOrderByID(c echo.Context) error {
 	orderUID := c.Param("id")
-	// Сначала кэш
-	start := time.Now()
-	if order, ok := h.cache.Get(orderUID); ok {
-		duration := time.Since(start)
-		h.log.Info("cache_hit", "order_uid", orderUID, "duration_ms", duration.Milliseconds())
-		return c.JSON(http.StatusOK, response.ToOrderResponse(order))
+	if asOf := c.QueryParam("as_of"); asOf != "" {
+		return h.getOrderAsOf(c, orderUID, asOf)
 	}
-	duration := time.Since(start)
-	h.log.Info("cache_miss", "order_uid", orderUID, "duration_ms", duration.Milliseconds())
-	// Фолбек в БД
-	var order models.Order
-	if err := h.storage.Db.Preload("Delivery").Preload("Payment").Preload("Items").Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
-		return c.JSON(http.StatusNotFound, response.ErrorResponse{
-			Error:   "not_found",
-			Message: "order not found",
-			Code:    http.StatusNotFound})
+	order, err := h.orders.GetOrder(c.Request().Context(), orderUID)
+	if err != nil {
+		return err
 	}
-	h.cache.Set(&order)
-	return c.JSON(http.StatusOK, response.ToOrderResponse(&order))
+	return c.JSON(http.StatusOK, response.ToOrderResponse(order, piiLevel(c.Request().Context())))
 }
 
 // UpdateOrder обновляет поля заказа и связанных сущностей
 func (h *Handler) UpdateOrder(c echo.Context) error {
 	var req request.UpdateOrderRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Error:   "bind_error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest})
-	}
-	// validate request
-	if err := req.Validate(); err != nil {
-		return c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Error:   "validation_error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
-	}
-
-	var order models.Order
-	if err := h.storage.Db.Preload("Delivery").Preload("Payment").Preload("Items").Where("order_uid = ?", req.OrderUID).First(&order).Error; err != nil {
-		return c.JSON(http.StatusNotFound, response.ErrorResponse{
-			Error:   "not_found",
-			Message: "order not found",
-			Code:    http.StatusNotFound})
+		return bindError(err)
 	}
-
-	req.UpdateOrderModel(&order)
-
-	// Сохраняем основные поля заказа
-	if err := h.storage.Db.Save(&order).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Error:   "update_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError})
-	}
-	// Сохраняем связанные сущности
-	if err := h.storage.Db.Save(&order.Delivery).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Error:   "update_delivery_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError})
-	}
-	if err := h.storage.Db.Save(&order.Payment).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Error:   "update_payment_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError})
-	}
-	for i := range order.Items {
-		order.Items[i].OrderID = order.ID
-		if err := h.storage.Db.Save(&order.Items[i]).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-				Error:   "update_item_error",
-				Message: err.Error(),
-				Code:    http.StatusInternalServerError})
-		}
+	// Заказ и связанные сущности сохраняются в одной транзакции вместе с записью в журнал изменений
+	order, err := h.orders.UpdateOrder(c.Request().Context(), &req)
+	if err != nil {
+		return err
 	}
 
-	h.cache.Set(&order)
-
 	return c.JSON(http.StatusOK, response.SuccessResponse{
 		Success: true,
 		Message: "order updated",
-		Data:    response.ToOrderResponse(&order)})
+		Data:    response.ToOrderResponse(order, piiLevel(c.Request().Context()))})
 }
 
 // DeleteOrder удаляет заказ и очищает соответствующую запись в кэше
 func (h *Handler) DeleteOrder(c echo.Context) error {
 	var req response.DeleteOrderRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Error:   "bind_error",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest})
+		return bindError(err)
 	}
-
-	uid, err := h.storage.DeleteOrder(req.OrderUID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Error:   "delete_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+	if err := h.orders.DeleteOrder(c.Request().Context(), req.OrderUID); err != nil {
+		return err
 	}
-
-	// очистим из кэша
-	h.cache.Delete(uid)
 	return c.JSON(http.StatusOK, response.SuccessResponse{
 		Success: true,
-		Message: "order: " + uid + " deleted",
+		Message: "order: " + req.OrderUID + " deleted",
 	})
 }
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"WB2/internal/dto/request"
+	"WB2/internal/dto/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TransitionOrder переводит заказ в новый статус; недопустимый переход отклоняется с 409
+func (h *Handler) TransitionOrder(c echo.Context) error {
+	orderUID := c.Param("id")
+	var req request.TransitionOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return bindError(err)
+	}
+	to, err := req.Validate()
+	if err != nil {
+		return err
+	}
+
+	order, err := h.orders.TransitionOrderStatus(c.Request().Context(), orderUID, to, req.Reason)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, response.SuccessResponse{
+		Success: true,
+		Message: "order status changed to " + string(order.Status),
+		Data:    response.ToOrderResponse(order, piiLevel(c.Request().Context()))})
+}
+
+// GetOrderTransitions возвращает текущий статус заказа, допустимые переходы и историю смены статусов
+func (h *Handler) GetOrderTransitions(c echo.Context) error {
+	order, history, err := h.orders.GetOrderTransitions(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.ToOrderStatusResponse(order, history))
+}
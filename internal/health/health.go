@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status - состояние компонента или сервиса целиком
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// CheckFunc проверяет компонент; ошибка означает, что компонент не готов.
+// details - дополнительные сведения для ответа (могут быть и при ошибке)
+type CheckFunc func(ctx context.Context) (details map[string]any, err error)
+
+// ComponentReport - результат проверки одного компонента
+type ComponentReport struct {
+	Status     Status         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+}
+
+// Report - результат проверки готовности сервиса
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentReport `json:"components"`
+}
+
+// Checker хранит проверки компонентов; компоненты можно регистрировать по мере запуска
+type Checker struct {
+	mu      sync.RWMutex
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+// NewChecker создаёт Checker; timeout ограничивает время каждой проверки
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{checks: make(map[string]CheckFunc), timeout: timeout}
+}
+
+// Register добавляет (или заменяет) проверку компонента name
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	c.checks[name] = check
+	c.mu.Unlock()
+}
+
+// Check параллельно выполняет все проверки. Сервис готов, только если готовы все компоненты
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	reports := make([]ComponentReport, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = c.run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: make(map[string]ComponentReport, len(names))}
+	for i, name := range names {
+		report.Components[name] = reports[i]
+		if reports[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check CheckFunc) ComponentReport {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	details, err := check(ctx)
+	r := ComponentReport{Status: StatusUp, Details: details, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		r.Status = StatusDown
+		r.Error = err.Error()
+	}
+	return r
+}
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"WB2/internal/metrics"
+)
+
+// storageBreaker - автомат защиты хранилища. После threshold подряд записей, не удавшихся из-за
+// недоступности БД, он размыкается: партиции ставятся на паузу (onOpen), обработчики ждут в wait,
+// не трогая БД и не сдвигая смещения. На паузе БД периодически проверяется probe; после успешной
+// проверки чтение возобновляется (onClose), но первая же неудачная запись снова размыкает автомат
+type storageBreaker struct {
+	log           *slog.Logger
+	threshold     int
+	probeInterval time.Duration
+	probe         func(ctx context.Context) error
+	// onOpen и onClose ставят партиции на паузу и снимают с неё; вызываются под mu
+	onOpen, onClose func()
+	// newTicker запускает тикер проверок БД и возвращает его канал и остановку; в тестах подменяется
+	newTicker func(d time.Duration) (<-chan time.Time, func())
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	// closed закрывается, когда автомат снова замыкается; обработчики ждут на нём в wait
+	closed chan struct{}
+}
+
+func newStorageBreaker(log *slog.Logger, threshold int, probeInterval time.Duration, probe func(ctx context.Context) error) *storageBreaker {
+	return &storageBreaker{
+		log:           log,
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		probe:         probe,
+		onOpen:        func() {},
+		onClose:       func() {},
+		newTicker: func(d time.Duration) (<-chan time.Time, func()) {
+			t := time.NewTicker(d)
+			return t.C, t.Stop
+		},
+	}
+}
+
+func (b *storageBreaker) enabled() bool {
+	return b.threshold > 0 && b.probeInterval > 0 && b.probe != nil
+}
+
+// success сбрасывает счётчик ошибок: БД ответила
+func (b *storageBreaker) success() {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	b.failures = 0
+	b.mu.Unlock()
+}
+
+// failure учитывает запись, не удавшуюся из-за недоступности БД, и размыкает автомат на пороге
+func (b *storageBreaker) failure(err error) {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.open || b.failures < b.threshold {
+		return
+	}
+	b.open = true
+	b.closed = make(chan struct{})
+	b.onOpen()
+	metrics.KafkaBreakerTrips.Inc()
+	metrics.KafkaConsumerPaused.Set(1)
+	b.log.Error("storage is unavailable, pausing kafka consumption", slog.Int("failures", b.failures),
+		slog.String("err", err.Error()))
+}
+
+// wait ждёт, пока автомат замкнут. Возвращает false, если ctx завершился раньше
+func (b *storageBreaker) wait(ctx context.Context) bool {
+	b.mu.Lock()
+	open, closed := b.open, b.closed
+	b.mu.Unlock()
+	if !open {
+		return true
+	}
+	select {
+	case <-closed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ifOpen вызывает fn, если автомат разомкнут; размыкание и замыкание ждут завершения fn.
+// Нужен, чтобы поставить на паузу партицию, полученную после ребалансировки
+func (b *storageBreaker) ifOpen(fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		fn()
+	}
+}
+
+// watch проверяет БД каждые probeInterval, пока автомат разомкнут, и замыкает его после успешной
+// проверки. Работает до отмены ctx
+func (b *storageBreaker) watch(ctx context.Context) {
+	if !b.enabled() {
+		return
+	}
+	ticks, stop := b.newTicker(b.probeInterval)
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+		b.mu.Lock()
+		open := b.open
+		b.mu.Unlock()
+		if !open {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, b.probeInterval)
+		err := b.probe(probeCtx)
+		cancel()
+		if err != nil {
+			b.log.Warn("storage probe failed, kafka consumption stays paused", slog.String("err", err.Error()))
+			continue
+		}
+		b.mu.Lock()
+		b.open = false
+		// полуоткрытое состояние: одна неудачная запись снова ставит чтение на паузу
+		b.failures = b.threshold - 1
+		close(b.closed)
+		b.onClose()
+		b.mu.Unlock()
+		metrics.KafkaConsumerPaused.Set(0)
+		b.log.Info("storage probe succeeded, resuming kafka consumption")
+	}
+}
@@ -0,0 +1,238 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"WB2/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock - часы consumerState, которые двигает тест
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// fakeProbe - проверка БД, результат которой задаёт тест
+type fakeProbe struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (p *fakeProbe) probe(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.err
+}
+
+func (p *fakeProbe) set(err error) {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
+
+func (p *fakeProbe) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// breakerHarness - consumer с автоматом защиты хранилища, тикером проверок по команде теста и часами теста
+type breakerHarness struct {
+	t       *testing.T
+	cons    *Consumer
+	group   *fakeGroup
+	probe   *fakeProbe
+	clock   *fakeClock
+	ticks   chan time.Time
+	trips   float64
+	waiters sync.WaitGroup
+}
+
+func newBreakerHarness(t *testing.T, threshold int) *breakerHarness {
+	h := &breakerHarness{
+		t:     t,
+		group: newFakeGroup(0),
+		probe: &fakeProbe{},
+		clock: &fakeClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		ticks: make(chan time.Time),
+		trips: testutil.ToFloat64(metrics.KafkaBreakerTrips),
+	}
+	h.cons = newTestConsumer(t, nil, h.group, claimConfig{})
+	h.cons.state.now = h.clock.Now
+	h.cons.state.setRunning(true)
+	h.cons.state.sessionStarted()
+	h.cons.breaker = newStorageBreaker(discardLog, threshold, time.Second, h.probe.probe)
+	h.cons.breaker.newTicker = func(time.Duration) (<-chan time.Time, func()) { return h.ticks, func() {} }
+	h.cons.pauseOnBreaker()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.cons.breaker.watch(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		h.waiters.Wait()
+		metrics.KafkaConsumerPaused.Set(0)
+	})
+	return h
+}
+
+// tick отдаёт watch тик проверки и дожидается его обработки: следующий тик watch принимает,
+// только закончив предыдущий. Если автомат ещё разомкнут, второй тик - ещё одна проверка
+func (h *breakerHarness) tick() {
+	h.ticks <- h.clock.Now()
+	h.ticks <- h.clock.Now()
+}
+
+// expect проверяет паузу группы, готовность consumer и метрики автомата
+func (h *breakerHarness) expect(step string, pauses, resumes int, trips float64) {
+	h.t.Helper()
+	gotPauses, gotResumes := h.group.pauseCounts()
+	if gotPauses != pauses || gotResumes != resumes {
+		h.t.Errorf("%s: PauseAll called %d times, ResumeAll %d, want %d and %d", step, gotPauses, gotResumes, pauses, resumes)
+	}
+	paused := pauses > resumes
+	details, err := h.cons.HealthCheck(time.Minute)(context.Background())
+	if details["paused"] != paused {
+		h.t.Errorf("%s: readiness paused = %v, want %v", step, details["paused"], paused)
+	}
+	if paused != (err != nil) {
+		h.t.Errorf("%s: readiness error %v, want paused %v", step, err, paused)
+	}
+	if paused && !strings.Contains(err.Error(), "paused") {
+		h.t.Errorf("%s: readiness error %q does not report the pause", step, err)
+	}
+	if got := testutil.ToFloat64(metrics.KafkaBreakerTrips) - h.trips; got != trips {
+		h.t.Errorf("%s: wb_kafka_breaker_trips_total grew by %v, want %v", step, got, trips)
+	}
+	wantGauge := 0.0
+	if paused {
+		wantGauge = 1
+	}
+	if got := testutil.ToFloat64(metrics.KafkaConsumerPaused); got != wantGauge {
+		h.t.Errorf("%s: consumer paused gauge %v, want %v", step, got, wantGauge)
+	}
+}
+
+// wait запускает обработчик, который ждёт замыкания автомата, и возвращает канал с его результатом
+func (h *breakerHarness) wait(ctx context.Context) <-chan bool {
+	res := make(chan bool, 1)
+	h.waiters.Add(1)
+	go func() {
+		defer h.waiters.Done()
+		res <- h.cons.breaker.wait(ctx)
+	}()
+	return res
+}
+
+func TestStorageBreakerPausesAndResumesConsumption(t *testing.T) {
+	h := newBreakerHarness(t, 3)
+	unavailable := errors.New("connection refused")
+
+	// замкнут: ошибки ниже порога и тики не трогают ни группу, ни БД
+	h.cons.breaker.failure(unavailable)
+	h.cons.breaker.failure(unavailable)
+	h.tick()
+	if n := h.probe.callCount(); n != 0 {
+		t.Fatalf("probe called %d times while the breaker is closed", n)
+	}
+	h.expect("closed", 0, 0, 0)
+
+	// порог: автомат размыкается, все партиции на паузе, обработчики ждут
+	h.cons.breaker.failure(unavailable)
+	h.expect("open", 1, 0, 1)
+	details, _ := h.cons.HealthCheck(time.Minute)(context.Background())
+	if details["paused_since"] != "2024-05-01T10:00:00Z" {
+		t.Errorf("paused_since = %v, want the trip time", details["paused_since"])
+	}
+	waiting := h.wait(t.Context())
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if <-h.wait(canceled) {
+		t.Error("wait returned true for a cancelled session while the breaker is open")
+	}
+
+	// ошибки на паузе не размыкают автомат повторно
+	h.cons.breaker.failure(unavailable)
+	h.expect("open, more failures", 1, 0, 1)
+
+	h.clock.advance(time.Minute)
+	if _, err := h.cons.HealthCheck(time.Minute)(context.Background()); err == nil || !strings.Contains(err.Error(), "paused for 1m0s") {
+		t.Errorf("readiness after a minute of pause: %v", err)
+	}
+
+	// неудачная проверка оставляет паузу
+	h.probe.set(unavailable)
+	h.tick()
+	if h.probe.callCount() == 0 {
+		t.Fatal("probe is not called while the breaker is open")
+	}
+	h.expect("probe failed", 1, 0, 1)
+	select {
+	case <-waiting:
+		t.Fatal("waiting worker released while the storage is unavailable")
+	default:
+	}
+
+	// успешная проверка: полуоткрытое состояние, чтение возобновлено, обработчики отпущены
+	h.probe.set(nil)
+	h.tick()
+	h.expect("half-open", 1, 1, 1)
+	if !<-waiting {
+		t.Fatal("waiting worker is not released after the probe succeeded")
+	}
+	calls := h.probe.callCount()
+	h.tick()
+	if h.probe.callCount() != calls {
+		t.Error("probe called after the breaker closed")
+	}
+
+	// в полуоткрытом состоянии первая же ошибка снова ставит чтение на паузу
+	h.cons.breaker.failure(unavailable)
+	h.expect("reopened from half-open", 2, 1, 2)
+
+	// после проверки и успешной записи автомат снова терпит ошибки до порога
+	h.tick()
+	h.cons.breaker.success()
+	h.cons.breaker.failure(unavailable)
+	h.cons.breaker.failure(unavailable)
+	h.expect("closed after success", 2, 2, 2)
+	h.cons.breaker.failure(unavailable)
+	h.expect("open again at threshold", 3, 2, 3)
+}
+
+// Отключённый автомат (нулевой порог) не ставит чтение на паузу и не блокирует обработчики
+func TestStorageBreakerDisabled(t *testing.T) {
+	h := newBreakerHarness(t, 0)
+	for range 10 {
+		h.cons.breaker.failure(errors.New("connection refused"))
+	}
+	h.expect("disabled", 0, 0, 0)
+	if !<-h.wait(context.Background()) {
+		t.Fatal("wait blocked with a disabled breaker")
+	}
+}
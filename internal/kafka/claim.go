@@ -0,0 +1,304 @@
+package kafka
+
+import (
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/metrics"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// workerQueueSize - сколько сообщений может ждать своей очереди у одного обработчика партиции
+	workerQueueSize = 64
+	// retryBackoff и maxRetryBackoff - пауза перед повтором сообщения, которое не удалось сохранить
+	retryBackoff    = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+// offsetTracker отслеживает обработку сообщений одной партиции, которые обрабатываются не по порядку,
+// и возвращает смещение для фиксации: все сообщения до него обработаны
+type offsetTracker struct {
+	mu sync.Mutex
+	// pending - смещения отданных в обработку сообщений по возрастанию
+	pending []int64
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool)}
+}
+
+// add регистрирует сообщение до передачи обработчику; вызывается в порядке чтения из партиции
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+}
+
+// complete отмечает сообщение обработанным. Если непрерывный обработанный префикс вырос,
+// возвращает смещение следующего за ним сообщения и true
+func (t *offsetTracker) complete(offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[offset] = true
+	var next int64
+	advanced := false
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		next = t.pending[0] + 1
+		t.pending = t.pending[1:]
+		advanced = true
+	}
+	return next, advanced
+}
+
+// claimConfig - параметры обработки одной партиции
+type claimConfig struct {
+	// workers - число параллельных обработчиков
+	workers int
+	// batchSize и batchTimeout - обработчик пишет заказы пачкой, набрав batchSize сообщений
+	// или через batchTimeout после первого сообщения пачки
+	batchSize    int
+	batchTimeout time.Duration
+}
+
+// claimProcessor обрабатывает сообщения одной партиции несколькими обработчиками.
+// Сообщения с одинаковым ключом (order_uid) всегда попадают к одному обработчику и идут
+// в порядке партиции; смещение фиксируется только до первого необработанного сообщения
+type claimProcessor struct {
+	h       *consumerGroupHandler
+	sess    sarama.ConsumerGroupSession
+	cfg     claimConfig
+	tracker *offsetTracker
+	queues  []chan *sarama.ConsumerMessage
+	wg      sync.WaitGroup
+}
+
+func newClaimProcessor(h *consumerGroupHandler, sess sarama.ConsumerGroupSession, cfg claimConfig) *claimProcessor {
+	cfg.workers = max(cfg.workers, 1)
+	cfg.batchSize = max(cfg.batchSize, 1)
+	p := &claimProcessor{
+		h:       h,
+		sess:    sess,
+		cfg:     cfg,
+		tracker: newOffsetTracker(),
+		queues:  make([]chan *sarama.ConsumerMessage, cfg.workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// run раздаёт сообщения партиции обработчикам до конца сессии или закрытия канала,
+// затем дожидается сообщений, которые уже в обработке
+func (p *claimProcessor) run(claim sarama.ConsumerGroupClaim) {
+	defer p.wait()
+	lag := metrics.KafkaConsumerLag.WithLabelValues(claim.Topic(), strconv.Itoa(int(claim.Partition())))
+	for {
+		select {
+		case <-p.sess.Context().Done():
+			return
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return
+			}
+			remaining := claim.HighWaterMarkOffset() - msg.Offset - 1
+			lag.Set(float64(remaining))
+			p.h.state.setLag(msg.Topic, msg.Partition, remaining)
+
+			p.tracker.add(msg.Offset)
+			select {
+			case p.queues[p.worker(msg.Key)] <- msg:
+			case <-p.sess.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func (p *claimProcessor) wait() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+}
+
+// worker выбирает обработчик по ключу сообщения. Сообщения без ключа идут к первому обработчику,
+// чтобы их взаимный порядок тоже сохранялся
+func (p *claimProcessor) worker(key []byte) int {
+	if len(key) == 0 || len(p.queues) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// work копит сообщения своей очереди в пачки и записывает их по порядку. После завершения сессии
+// оставшиеся в очереди и в неполной пачке сообщения не обрабатываются и будут получены снова
+func (p *claimProcessor) work(queue <-chan *sarama.ConsumerMessage) {
+	defer p.wg.Done()
+	batch := make([]*sarama.ConsumerMessage, 0, p.cfg.batchSize)
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) < p.cfg.batchSize {
+				if timer == nil {
+					timer = time.NewTimer(p.cfg.batchTimeout)
+					timeout = timer.C
+				}
+				continue
+			}
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		p.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush обрабатывает пачку. Подряд идущие заказы пишутся одной транзакцией, остальные события
+// применяются по одному между ними, так что события одного заказа идут в порядке партиции.
+// Смещения отмечаются, только когда обработана вся пачка
+func (p *claimProcessor) flush(batch []*sarama.ConsumerMessage) {
+	ctx := p.sess.Context()
+	if len(batch) == 0 || ctx.Err() != nil {
+		return
+	}
+	pending := make([]*orderMessage, 0, len(batch))
+	for _, msg := range batch {
+		if m := p.h.decode(ctx, msg); m != nil {
+			pending = append(pending, m)
+		}
+	}
+	defer func() {
+		for _, m := range pending {
+			m.span.End()
+		}
+	}()
+
+	for rest := pending; len(rest) > 0; {
+		n := 0
+		for n < len(rest) && rest[n].creates() {
+			n++
+		}
+		if n == 0 {
+			n = 1
+			if !p.retry(rest[0]) {
+				return
+			}
+		} else if !p.create(rest[:n]) {
+			return
+		}
+		rest = rest[n:]
+	}
+	p.complete(batch)
+}
+
+// create записывает заказы одной транзакцией. Пока хранилище недоступно, пачка повторяется целиком
+// с нарастающей паузой (и автоматом защиты хранилища), а не разбирается по одному: это не поможет и только
+// оттянет паузу чтения. Если пачка не записалась из-за данных (невалидный заказ, дубликат), заказы
+// сохраняются по одному, чтобы отделить плохую запись от остальных.
+// Возвращает false, если сессия завершилась раньше, чем все заказы удалось сохранить
+func (p *claimProcessor) create(run []*orderMessage) bool {
+	if len(run) > 1 {
+		ctx := p.sess.Context()
+		backoff := retryBackoff
+		for {
+			if !p.h.breaker.wait(ctx) {
+				return false
+			}
+			err := p.h.saveBatch(ctx, run)
+			if err == nil {
+				p.h.breaker.success()
+				return true
+			}
+			if !errors.Is(err, apperr.ErrUnavailable) {
+				metrics.KafkaBatchFallbacks.WithLabelValues(run[0].msg.Topic).Inc()
+				p.h.log.Warn("kafka batch failed, saving orders one by one", slog.Int("size", len(run)),
+					slog.String("err", err.Error()))
+				break
+			}
+			p.h.breaker.failure(err)
+			p.h.log.Warn("retrying kafka batch", slog.String("topic", run[0].msg.Topic), slog.Int("partition", int(run[0].msg.Partition)),
+				slog.Int64("offset", run[0].msg.Offset), slog.Int("size", len(run)), slog.Duration("backoff", backoff),
+				slog.String("err", err.Error()))
+			if !p.sleep(backoff) {
+				return false
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+		}
+	}
+	for _, m := range run {
+		if !p.retry(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// retry применяет событие, повторяя попытку с нарастающей паузой, пока хранилище недоступно:
+// следующие сообщения того же ключа ждут, а смещение партиции не сдвигается дальше него.
+// Пока автомат защиты хранилища разомкнут, попытки не делаются вовсе.
+// Возвращает false, если сессия завершилась раньше, чем событие удалось применить
+func (p *claimProcessor) retry(m *orderMessage) bool {
+	ctx := p.sess.Context()
+	backoff := retryBackoff
+	for {
+		if !p.h.breaker.wait(ctx) {
+			return false
+		}
+		err := p.h.save(m)
+		if err == nil {
+			p.h.breaker.success()
+			return true
+		}
+		p.h.breaker.failure(err)
+		p.h.log.Warn("retrying kafka message", slog.String("topic", m.msg.Topic), slog.Int("partition", int(m.msg.Partition)),
+			slog.Int64("offset", m.msg.Offset), slog.Duration("backoff", backoff), slog.String("err", err.Error()))
+		if !p.sleep(backoff) {
+			return false
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// sleep ждёт паузу перед повтором. Возвращает false, если сессия завершилась раньше
+func (p *claimProcessor) sleep(d time.Duration) bool {
+	select {
+	case <-p.sess.Context().Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// complete отмечает сообщения пачки обработанными и сдвигает смещение партиции, если это возможно
+func (p *claimProcessor) complete(batch []*sarama.ConsumerMessage) {
+	for _, msg := range batch {
+		if next, ok := p.tracker.complete(msg.Offset); ok {
+			p.sess.MarkOffset(msg.Topic, msg.Partition, next, "")
+		}
+		p.h.state.progressed()
+	}
+}
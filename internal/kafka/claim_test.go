@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"WB2/internal/service/servicetest"
+	"WB2/internal/storage/postgres/storagetest"
+
+	"github.com/IBM/sarama"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// filledClaim возвращает партицию с заказами по смещениям 0..n-1, после которых канал закрыт
+func filledClaim(t testing.TB, n int) *fakeClaim {
+	messages := make(chan *sarama.ConsumerMessage, n)
+	for i := range int64(n) {
+		messages <- testMessage(t, i, offsetUID(i))
+	}
+	close(messages)
+	return &fakeClaim{messages: messages}
+}
+
+// Пока хранилище недоступно, пачка повторяется целиком: разбор по одному заказу не поможет
+// и только умножит запросы к лежащей БД
+func TestClaimRetriesUnavailableBatchAsWhole(t *testing.T) {
+	const total = 10
+	repo := servicetest.NewMemoryRepository()
+	repo.FailWith(driver.ErrBadConn)
+	group := newFakeGroup(0)
+	h := testHandler(newTestConsumer(t, newTestService(repo), group, claimConfig{}))
+	sess := &fakeSession{ctx: t.Context(), group: group}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newClaimProcessor(h, sess, claimConfig{workers: 1, batchSize: total, batchTimeout: time.Second}).run(filledClaim(t, total))
+	}()
+
+	waitFor(t, "batch retry", func() bool { return repo.Calls("CreateOrdersBatch") >= 2 })
+	if n := repo.Calls("CreateOrder"); n != 0 {
+		t.Fatalf("CreateOrder called %d times while the store is unavailable, want batch retries only", n)
+	}
+	if got := group.markedOffset(); got != 0 {
+		t.Fatalf("marked offset %d while the batch is not saved", got)
+	}
+
+	repo.FailWith(nil)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("batch is not saved after the store recovered")
+	}
+	if got := group.markedOffset(); got != total {
+		t.Errorf("marked offset %d, want %d", got, total)
+	}
+	if repo.Len() != total {
+		t.Errorf("saved %d orders, want %d", repo.Len(), total)
+	}
+	if n := repo.Calls("CreateOrder"); n != 0 {
+		t.Errorf("CreateOrder called %d times, want the batch saved in one transaction", n)
+	}
+}
+
+// Ошибка данных в пачке по-прежнему разбирается по одному заказу: дубликат пропускается, остальные сохраняются
+func TestClaimFallsBackPerRecordOnDuplicate(t *testing.T) {
+	const total = 10
+	repo := servicetest.NewMemoryRepository()
+	orders := newTestService(repo)
+	group := newFakeGroup(0)
+	h := testHandler(newTestConsumer(t, orders, group, claimConfig{}))
+	if err := h.save(h.decode(context.Background(), testMessage(t, 3, offsetUID(3)))); err != nil {
+		t.Fatal(err)
+	}
+
+	sess := &fakeSession{ctx: t.Context(), group: group}
+	newClaimProcessor(h, sess, claimConfig{workers: 1, batchSize: total, batchTimeout: time.Second}).run(filledClaim(t, total))
+
+	if got := group.markedOffset(); got != total {
+		t.Errorf("marked offset %d, want %d", got, total)
+	}
+	if repo.Len() != total {
+		t.Errorf("saved %d orders, want %d", repo.Len(), total)
+	}
+	if n := repo.Calls("CreateOrder"); n != total+1 {
+		t.Errorf("CreateOrder called %d times, want %d after the batch fell back", n, total+1)
+	}
+}
+
+func BenchmarkClaimPerRecord(b *testing.B) {
+	benchmarkClaim(b, claimConfig{workers: 4, batchSize: 1})
+}
+
+func BenchmarkClaimBatched(b *testing.B) {
+	benchmarkClaim(b, claimConfig{workers: 4, batchSize: 100, batchTimeout: 5 * time.Millisecond})
+}
+
+// benchmarkClaim измеряет обработку партиции из 1000 заказов с записью в БД: в SQLite в файле
+// и, если задан TEST_POSTGRES_DSN, в PostgreSQL. Каждая итерация пишет в новую пустую базу
+func benchmarkClaim(b *testing.B, cfg claimConfig) {
+	const total = 1000
+	messages := make([]*sarama.ConsumerMessage, total)
+	for i := range int64(total) {
+		messages[i] = testMessage(b, i, offsetUID(i))
+	}
+	for _, backend := range storagetest.Backends(b, storagetest.InFile) {
+		b.Run(backend.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				b.StopTimer()
+				db := backend.Open(b)
+				// журнал SQL-запросов хранилища замедлил бы запись сильнее самой БД
+				db.Db.Logger = gormlogger.Discard
+				group := newFakeGroup(0)
+				h := testHandler(newTestConsumer(b, newTestService(db), group, cfg))
+				claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, total)}
+				for _, msg := range messages {
+					claim.messages <- msg
+				}
+				close(claim.messages)
+				b.StartTimer()
+
+				newClaimProcessor(h, &fakeSession{ctx: b.Context(), group: group}, cfg).run(claim)
+
+				b.StopTimer()
+				if got := group.markedOffset(); got != total {
+					b.Fatalf("marked offset %d, want %d", got, total)
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(total*b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
+
+// waitFor ждёт выполнения cond не дольше 10 секунд
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
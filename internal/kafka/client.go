@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"fmt"
+
+	"WB2/internal/config"
+
+	"github.com/IBM/sarama"
+)
+
+// newClientConfig собирает конфигурацию sarama из config.Kafka; общая для consumer, producer и служебных команд
+func newClientConfig(kc config.Kafka) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	if v, err := sarama.ParseKafkaVersion(kc.Version); err == nil {
+		cfg.Version = v
+	}
+
+	switch kc.InitialOffset {
+	case "", "newest", "latest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest", "earliest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, fmt.Errorf("unknown kafka.initial_offset %q: want newest or oldest", kc.InitialOffset)
+	}
+
+	switch kc.RebalanceStrategy {
+	case "", sarama.RangeBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case sarama.RoundRobinBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case sarama.StickyBalanceStrategyName:
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	case "cooperative", "cooperative-sticky":
+		// sarama поддерживает только eager-протокол: при ребалансировке у всех участников отзываются все партиции
+		return nil, fmt.Errorf("kafka.rebalance_strategy %q is not supported: the sarama client implements only eager rebalancing; "+
+			"use sticky to keep the most assignments", kc.RebalanceStrategy)
+	default:
+		return nil, fmt.Errorf("unknown kafka.rebalance_strategy %q: want range, roundrobin or sticky", kc.RebalanceStrategy)
+	}
+
+	if kc.SessionTimeout > 0 {
+		cfg.Consumer.Group.Session.Timeout = kc.SessionTimeout
+	}
+	if kc.HeartbeatInterval > 0 {
+		cfg.Consumer.Group.Heartbeat.Interval = kc.HeartbeatInterval
+	}
+	if kc.RebalanceTimeout > 0 {
+		cfg.Consumer.Group.Rebalance.Timeout = kc.RebalanceTimeout
+	}
+	if err := applySecurity(cfg, kc); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka config: %w", err)
+	}
+	return cfg, nil
+}
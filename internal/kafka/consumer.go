@@ -2,55 +2,136 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
-	"WB2/internal/cache"
-	"WB2/internal/dto/response"
+	"WB2/internal/apperr"
+	"WB2/internal/audit"
+	"WB2/internal/config"
+	"WB2/internal/decode"
+	"WB2/internal/dto/request"
+	"WB2/internal/metrics"
 	"WB2/internal/models"
-	storage "WB2/internal/storage/postgres"
+	"WB2/internal/service"
+	"WB2/internal/tracing"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Consumer отвечает за чтение сообщений из Kafka и обработку заказов
 type Consumer struct {
-	log   *slog.Logger
-	store *storage.Storage
-	cache *cache.OrderCache
-	group sarama.ConsumerGroup
-	topic string
+	log    *slog.Logger
+	orders *service.OrderService
+	group  sarama.ConsumerGroup
+	topics []string
+	state  *consumerState
+	claims claimConfig
+	// decoders разбирают сообщения по заголовкам content-type и schema-version
+	decoders *decode.Registry
+	// breaker ставит чтение на паузу, пока БД недоступна
+	breaker *storageBreaker
+
+	// cancel и done управляют циклом чтения, запущенным через Start
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
-func NewConsumer(log *slog.Logger, store *storage.Storage, c *cache.OrderCache, brokers []string, groupID, topic string, version string) (*Consumer, error) {
-	cfg := sarama.NewConfig()
-	cfg.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
-	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
-	if v, err := sarama.ParseKafkaVersion(version); err == nil {
-		cfg.Version = v
+// NewConsumer создаёт consumer группы kc.GroupID. probe проверяет доступность БД, пока чтение
+// приостановлено автоматом защиты хранилища (kc.Breaker)
+func NewConsumer(log *slog.Logger, orders *service.OrderService, kc config.Kafka, probe func(ctx context.Context) error) (*Consumer, error) {
+	cfg, err := newClientConfig(kc)
+	if err != nil {
+		return nil, err
 	}
-	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	decoders, err := decode.NewRegistry(kc.Decoding.AvroSchemaDir)
 	if err != nil {
 		return nil, err
 	}
-	return &Consumer{
-		log:   log,
-		store: store,
-		cache: c,
-		group: group,
-		topic: topic,
-	}, nil
+	group, err := sarama.NewConsumerGroup(kc.Brokers, kc.GroupID, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &Consumer{
+		log:    log,
+		orders: orders,
+		group:  group,
+		topics: kc.TopicList(),
+		state:  newConsumerState(),
+		claims: claimConfig{
+			workers:      kc.Workers,
+			batchSize:    kc.BatchSize,
+			batchTimeout: kc.BatchTimeout,
+		},
+		decoders: decoders,
+		breaker:  newStorageBreaker(log, kc.Breaker.FailureThreshold, kc.Breaker.ProbeInterval, probe),
+	}
+	c.pauseOnBreaker()
+	return c, nil
+}
+
+// pauseOnBreaker ставит все партиции группы на паузу, пока автомат защиты хранилища разомкнут,
+// и отражает паузу в проверке готовности
+func (c *Consumer) pauseOnBreaker() {
+	c.breaker.onOpen = func() {
+		c.group.PauseAll()
+		c.state.setPaused(true)
+	}
+	c.breaker.onClose = func() {
+		c.group.ResumeAll()
+		c.state.setPaused(false)
+	}
 }
 
 func (c *Consumer) Close() error { return c.group.Close() }
 
+// Start запускает цикл чтения в фоне; остановка - через Stop
+func (c *Consumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		if err := c.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			c.log.Error("Kafka consumer stopped", slog.String("err", err.Error()))
+		}
+	}()
+}
+
+// Stop завершает сессию группы: обработчики дописывают сообщения, которые уже в работе,
+// новые не берутся, смещения обработанных фиксируются. Затем группа закрывается.
+// Если ctx истёк раньше, группа закрывается без ожидания
+func (c *Consumer) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return errors.Join(fmt.Errorf("drain consumer: %w", ctx.Err()), c.Close())
+		}
+	}
+	return c.Close()
+}
+
 func (c *Consumer) Run(ctx context.Context) error {
-	handler := &consumerGroupHandler{log: c.log, store: c.store, cache: c.cache}
+	c.state.setRunning(true)
+	defer c.state.setRunning(false)
+	go c.breaker.watch(ctx)
+	handler := &consumerGroupHandler{log: c.log, orders: c.orders, group: c.group, state: c.state, claims: c.claims,
+		decoders: c.decoders, breaker: c.breaker}
 	for {
-		if err := c.group.Consume(ctx, []string{c.topic}, handler); err != nil {
+		if err := c.group.Consume(ctx, c.topics, handler); err != nil {
 			c.log.Error("kafka consume error", slog.String("err", err.Error()))
-			time.Sleep(2 * time.Second)
+			c.state.setError(err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * time.Second):
+			}
 		}
 		if ctx.Err() != nil {
 			return ctx.Err()
@@ -59,102 +140,197 @@ func (c *Consumer) Run(ctx context.Context) error {
 }
 
 type consumerGroupHandler struct {
-	log   *slog.Logger
-	store *storage.Storage
-	cache *cache.OrderCache
+	log      *slog.Logger
+	orders   *service.OrderService
+	group    sarama.ConsumerGroup
+	state    *consumerState
+	claims   claimConfig
+	decoders *decode.Registry
+	breaker  *storageBreaker
 }
 
-func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
-func (h *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+// Setup вызывается в начале каждой сессии группы, то есть после каждой ребалансировки
+func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+	metrics.KafkaRebalances.Inc()
+	h.state.sessionStarted()
+	return nil
+}
 
-// ConsumeClaim получает сообщения, валидирует полезную нагрузку и сохраняет заказ в БД с кэшированием
+// Cleanup вызывается после завершения всех ConsumeClaim сессии: отмеченные смещения
+// фиксируются синхронно, не дожидаясь периодического автокоммита
+func (h *consumerGroupHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	sess.Commit()
+	h.state.sessionEnded()
+	return nil
+}
+
+// ConsumeClaim получает сообщения, валидирует полезную нагрузку и сохраняет заказы в БД с кэшированием.
+// Сообщения партиции обрабатываются параллельно с сохранением порядка по ключу и пишутся пачками
+// (см. claimProcessor). При завершении сессии (остановка или ребалансировка) пачки, которые уже
+// записываются, дописываются, а остальные сообщения остаются неотмеченными и будут получены снова.
+// Партиция, полученная, пока чтение приостановлено автоматом защиты хранилища, сразу ставится на паузу
 func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for msg := range claim.Messages() {
-		// ожидаем JSON с полями, соответствующими CreateOrderRequest (кроме автогенерируемого UID/DateCreated)
-		var input response.OrderResponse
-		if err := json.Unmarshal(msg.Value, &input); err != nil {
-			h.log.Error("failed to decode kafka message", slog.String("err", err.Error()))
-			sess.MarkMessage(msg, "bad_json")
-			continue
-		}
+	h.breaker.ifOpen(func() {
+		h.group.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	})
+	newClaimProcessor(h, sess, h.claims).run(claim)
+	return nil
+}
 
-		// базовая валидация обязательных полей
-		if input.OrderUID == "" {
-			h.log.Error("invalid message: missing order_uid")
-			sess.MarkMessage(msg, "bad_payload")
-			continue
-		}
-		if len(input.Items) == 0 {
-			h.log.Error("invalid message: empty items", slog.String("order_uid", input.OrderUID))
-			sess.MarkMessage(msg, "bad_payload")
-			continue
+// orderMessage - разобранное событие заказа, ожидающее записи. Спан сообщения
+// продолжает трассу producer'а из заголовков и закрывается после записи
+type orderMessage struct {
+	msg   *sarama.ConsumerMessage
+	ctx   context.Context
+	span  trace.Span
+	event *request.OrderEvent
+}
+
+// creates сообщает, что сообщение создаёт заказ; такие сообщения пишутся пачками
+func (m *orderMessage) creates() bool {
+	return m.event.Type == request.EventOrderCreated
+}
+
+func (m *orderMessage) fail(reason string, err error) {
+	metrics.KafkaMessagesFailed.WithLabelValues(m.msg.Topic, reason).Inc()
+	m.span.SetStatus(codes.Error, reason)
+	if err != nil {
+		m.span.RecordError(err)
+	}
+}
+
+// decode разбирает сообщение декодером по его заголовкам и открывает спан. Сообщение, которое нельзя
+// обработать (неизвестный формат, тело не соответствует схеме, нет order_uid), учитывается как отклонённое,
+// и decode возвращает nil. Контекст не отменяется вместе с сессией, чтобы начатая запись в БД не обрывалась при остановке
+func (h *consumerGroupHandler) decode(ctx context.Context, msg *sarama.ConsumerMessage) *orderMessage {
+	ctx = tracing.ExtractKafka(context.WithoutCancel(ctx), msg)
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.consume "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.Int("messaging.kafka.destination.partition", int(msg.Partition)),
+			attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+		))
+	m := &orderMessage{msg: msg, ctx: audit.WithActor(ctx, audit.KafkaActor(msg.Topic)), span: span}
+
+	contentType, version := header(msg, decode.HeaderContentType), header(msg, decode.HeaderSchemaVersion)
+	span.SetAttributes(attribute.String("messaging.message.content_type", contentType), attribute.String("messaging.message.schema_version", version))
+	event, err := h.decoders.Decode(contentType, version, msg.Value)
+	if err != nil {
+		reason := "decode_error"
+		if errors.Is(err, decode.ErrUnsupported) {
+			reason = "unsupported_format"
 		}
+		h.log.Error("failed to decode kafka message", slog.String("topic", msg.Topic), slog.String("content_type", contentType),
+			slog.String("schema_version", version), slog.String("err", err.Error()))
+		m.fail(reason, err)
+		span.End()
+		return nil
+	}
+	m.event = event
+	span.SetAttributes(attribute.String("order.uid", event.OrderUID), attribute.String("order.event_type", event.Type))
 
-		order := toOrderModelFromResponse(&input)
-		if err := h.store.Db.Create(order).Error; err != nil {
-			h.log.Error("failed to save order", slog.String("err", err.Error()))
+	// order_uid обязателен - по нему повторы распознаются как дубликаты, а события находят свой заказ
+	if event.OrderUID == "" {
+		h.log.Error("invalid message: missing order_uid")
+		m.fail("bad_payload", nil)
+		span.End()
+		return nil
+	}
+	return m
+}
+
+// saveBatch сохраняет заказы пачки одной транзакцией в спане, связанном со спанами сообщений
+func (h *consumerGroupHandler) saveBatch(ctx context.Context, batch []*orderMessage) error {
+	topic := batch[0].msg.Topic
+	links := make([]trace.Link, len(batch))
+	inputs := make([]*request.CreateOrderRequest, len(batch))
+	for i, m := range batch {
+		links[i] = trace.Link{SpanContext: m.span.SpanContext()}
+		inputs[i] = m.event.Created
+	}
+	ctx = audit.WithActor(context.WithoutCancel(ctx), audit.KafkaActor(topic))
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.consume_batch "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.Int("messaging.batch.message_count", len(batch)),
+		))
+	defer span.End()
+
+	if _, err := h.orders.CreateOrders(ctx, inputs); err != nil {
+		span.SetStatus(codes.Error, "batch failed")
+		span.RecordError(err)
+		return err
+	}
+	metrics.KafkaBatchSize.WithLabelValues(topic).Observe(float64(len(batch)))
+	metrics.KafkaEvents.WithLabelValues(topic, request.EventOrderCreated, models.EventApplied).Add(float64(len(batch)))
+	metrics.KafkaMessagesProcessed.WithLabelValues(topic).Add(float64(len(batch)))
+	return nil
+}
+
+// save применяет одно событие. Ошибка возвращается, только если хранилище недоступно и сообщение
+// стоит повторить; невалидные и неприменимые события, дубликаты и устаревшие события считаются обработанными
+func (h *consumerGroupHandler) save(m *orderMessage) error {
+	uid, typ := m.event.OrderUID, m.event.Type
+	outcome, err := h.orders.ApplyEvent(m.ctx, m.event)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperr.ErrValidation):
+			h.log.Error("invalid message", slog.String("order_uid", uid), slog.String("event", typ), slog.String("err", err.Error()))
+			m.fail("bad_payload", err)
+		case errors.Is(err, apperr.ErrNotFound):
+			// событие пришло раньше заказа или для удалённого заказа; ждать его бессмысленно
+			h.log.Error("order event for unknown order", slog.String("order_uid", uid), slog.String("event", typ), slog.String("err", err.Error()))
+			m.fail("order_not_found", err)
+		case errors.Is(err, apperr.ErrConflict):
+			h.log.Error("order event rejected", slog.String("order_uid", uid), slog.String("event", typ), slog.String("err", err.Error()))
+			m.fail("rejected", err)
+		case errors.Is(err, apperr.ErrUnavailable):
+			h.log.Error("failed to save order", slog.String("order_uid", uid), slog.String("err", err.Error()))
+			m.fail("save_error", err)
+			return err
+		default:
+			// повтор не поможет: сообщение пропускается, чтобы не блокировать заказы за ним
+			h.log.Error("failed to save order", slog.String("order_uid", uid), slog.String("err", err.Error()))
+			m.fail("save_error", err)
+		}
+		return nil
+	}
+	metrics.KafkaEvents.WithLabelValues(m.msg.Topic, typ, outcome).Inc()
+	m.span.SetAttributes(attribute.String("order.event_outcome", outcome))
+	switch outcome {
+	case models.EventDuplicate:
+		if m.creates() {
+			// повторная доставка уже сохранённого заказа
+			h.log.Warn("order already exists", slog.String("order_uid", uid))
 		} else {
-			h.cache.Set(order)
-			sess.MarkMessage(msg, "ok")
+			h.log.Warn("order event already processed", slog.String("order_uid", uid), slog.String("event", typ), slog.String("event_id", m.event.ID))
 		}
+		m.fail("duplicate", nil)
+		return nil
+	case models.EventStale:
+		h.log.Warn("stale order event skipped", slog.String("order_uid", uid), slog.String("event", typ),
+			slog.Time("occurred_at", m.event.OccurredAt))
+		m.fail("stale", nil)
+		return nil
+	}
+	if m.creates() {
+		metrics.KafkaBatchSize.WithLabelValues(m.msg.Topic).Observe(1)
 	}
+	metrics.KafkaMessagesProcessed.WithLabelValues(m.msg.Topic).Inc()
 	return nil
 }
 
-func toOrderModelFromResponse(resp *response.OrderResponse) *models.Order {
-	order := &models.Order{
-		OrderUID:          resp.OrderUID,
-		TrackNumber:       resp.TrackNumber,
-		Entry:             resp.Entry,
-		Locale:            resp.Locale,
-		InternalSignature: resp.InternalSignature,
-		CustomerID:        resp.CustomerID,
-		DeliveryService:   resp.DeliveryService,
-		ShardKey:          resp.ShardKey,
-		SmID:              resp.SmID,
-		DateCreated:       resp.DateCreated,
-		OofShard:          resp.OofShard,
-	}
-
-	order.Delivery = models.Delivery{
-		Name:    resp.Delivery.Name,
-		Phone:   resp.Delivery.Phone,
-		Zip:     resp.Delivery.Zip,
-		City:    resp.Delivery.City,
-		Address: resp.Delivery.Address,
-		Region:  resp.Delivery.Region,
-		Email:   resp.Delivery.Email,
-	}
-
-	order.Payment = models.Payment{
-		Transaction:  resp.Payment.Transaction,
-		RequestID:    resp.Payment.RequestID,
-		Currency:     resp.Payment.Currency,
-		Provider:     resp.Payment.Provider,
-		Amount:       resp.Payment.Amount,
-		PaymentDt:    resp.Payment.PaymentDt,
-		Bank:         resp.Payment.Bank,
-		DeliveryCost: resp.Payment.DeliveryCost,
-		GoodsTotal:   resp.Payment.GoodsTotal,
-		CustomFee:    resp.Payment.CustomFee,
-	}
-
-	order.Items = make([]models.Item, len(resp.Items))
-	for i := range resp.Items {
-		it := resp.Items[i]
-		order.Items[i] = models.Item{
-			ChrtID:      it.ChrtID,
-			TrackNumber: it.TrackNumber,
-			Price:       it.Price,
-			Rid:         it.Rid,
-			Name:        it.Name,
-			Sale:        it.Sale,
-			Size:        it.Size,
-			TotalPrice:  it.TotalPrice,
-			NmID:        it.NmID,
-			Brand:       it.Brand,
-			Status:      it.Status,
+// header возвращает значение заголовка сообщения; имя сравнивается без учёта регистра
+func header(msg *sarama.ConsumerMessage, name string) string {
+	for _, h := range msg.Headers {
+		if h != nil && strings.EqualFold(string(h.Key), name) {
+			return string(h.Value)
 		}
 	}
-	return order
+	return ""
 }
@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"WB2/internal/decode"
+	"WB2/internal/dto/request"
+	"WB2/internal/lifecycle"
+	"WB2/internal/metrics"
+	"WB2/internal/models"
+	storage "WB2/internal/storage/postgres"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func offsetUID(offset int64) string {
+	return fmt.Sprintf("order-%05d", offset)
+}
+
+// Остановка сервиса посреди потока не должна терять заказы: смещение фиксируется только за сохранёнными
+// заказами, а consumer останавливается раньше, чем закрывается БД
+func TestShutdownMidStreamCommitsOnlyPersistedOrders(t *testing.T) {
+	const total = 2000
+	path := filepath.Join(t.TempDir(), "orders.db")
+	db, err := storage.NewSQLiteStorage(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := newFakeGroup(total)
+	for i := range int64(total) {
+		group.messages <- testMessage(t, i, offsetUID(i))
+	}
+	// всё, что лежит до отмечаемого смещения, уже должно быть в БД
+	var (
+		mu      sync.Mutex
+		checked int64
+	)
+	persistedBefore := func(what string, next int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		for ; checked < next; checked++ {
+			if _, err := db.GetOrder(context.Background(), offsetUID(checked)); err != nil {
+				t.Errorf("%s offset %d before order %s is persisted: %v", what, next, offsetUID(checked), err)
+			}
+		}
+	}
+	group.onMark = func(next int64) { persistedBefore("marked", next) }
+	group.onCommit = func(next int64) { persistedBefore("committed", next) }
+
+	cons := newTestConsumer(t, newTestService(db), group, claimConfig{workers: 4, batchSize: 20, batchTimeout: 5 * time.Millisecond})
+	lc := lifecycle.NewManager(discardLog)
+	lc.Add(lifecycle.Component{Name: "database", Stop: func(context.Context) error { return db.Close() }})
+	lc.Add(lifecycle.Component{
+		Name:  "kafka_consumer",
+		Start: func(context.Context) error { cons.Start(); return nil },
+		Stop:  cons.Stop,
+	})
+	if err := lc.Start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for group.markedOffset() < total/10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("consumer marked only %d offsets", group.markedOffset())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := lifecycle.Err(lc.Stop(ctx)); err != nil {
+		t.Fatal(err)
+	}
+
+	group.mu.Lock()
+	committed, marked, closed := group.committed, group.marked, group.closed
+	group.mu.Unlock()
+	if !closed {
+		t.Error("consumer group is not closed")
+	}
+	if committed != marked {
+		t.Errorf("committed offset %d, marked %d: offsets marked before shutdown are not committed", committed, marked)
+	}
+	t.Logf("committed %d of %d messages before shutdown", committed, total)
+
+	// после перезапуска чтение продолжится с committed: каждый заказ до него должен быть в БД
+	db, err = storage.NewSQLiteStorage(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	for i := range committed {
+		if _, err := db.GetOrder(t.Context(), offsetUID(i)); err != nil {
+			t.Fatalf("order %s at committed offset %d is lost: %v", offsetUID(i), i, err)
+		}
+	}
+}
+
+// eventMessage - конверт события заказа uid с полезной нагрузкой payload
+func eventMessage(offset int64, id, typ, uid string, at time.Time, payload string) *sarama.ConsumerMessage {
+	body := fmt.Sprintf(`{"id":%q,"type":%q,"order_uid":%q,"occurred_at":%q,"payload":%s}`, id, typ, uid, at.Format(time.RFC3339), payload)
+	return &sarama.ConsumerMessage{
+		Topic: testTopic, Offset: offset, Key: []byte(uid), Value: []byte(body),
+		Headers: []*sarama.RecordHeader{{Key: []byte(decode.HeaderContentType), Value: []byte(decode.ContentTypeEvent)}},
+	}
+}
+
+// После перемотки смещения (или фиксации, не дошедшей до брокера) партиция читается повторно:
+// заказы и события, которые уже применены, пропускаются как дубликаты, а не падают ошибкой и не меняют заказы
+func TestRedeliveredPartitionIsNoop(t *testing.T) {
+	db, err := storage.NewSQLiteStorage(":memory:", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	stream := []*sarama.ConsumerMessage{testMessage(t, 0, offsetUID(0)), testMessage(t, 1, offsetUID(1)), testMessage(t, 2, offsetUID(2))}
+	stream = append(stream,
+		eventMessage(3, "update-1", request.EventOrderUpdated, offsetUID(0), at,
+			fmt.Sprintf(`{"order_uid":%q,"delivery":{"city":"Haifa"}}`, offsetUID(0))),
+		eventMessage(4, "cancel-1", request.EventOrderCancelled, offsetUID(1), at, `{"reason":"customer"}`),
+		testMessage(t, 5, offsetUID(3)),
+	)
+	consume := func() int64 {
+		group := newFakeGroup(0)
+		h := testHandler(newTestConsumer(t, newTestService(db), group, claimConfig{}))
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(stream))}
+		for _, msg := range stream {
+			claim.messages <- msg
+		}
+		close(claim.messages)
+		cfg := claimConfig{workers: 2, batchSize: len(stream), batchTimeout: time.Second}
+		newClaimProcessor(h, &fakeSession{ctx: t.Context(), group: group}, cfg).run(claim)
+		return group.markedOffset()
+	}
+
+	if got := consume(); got != int64(len(stream)) {
+		t.Fatalf("marked offset %d, want %d", got, len(stream))
+	}
+	audits := make(map[string]int)
+	for i := range int64(4) {
+		records, err := db.GetOrderAudit(t.Context(), offsetUID(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		audits[offsetUID(i)] = len(records)
+	}
+
+	failed := testutil.ToFloat64(metrics.KafkaMessagesFailed.WithLabelValues(testTopic, "save_error"))
+	duplicates := testutil.ToFloat64(metrics.KafkaMessagesFailed.WithLabelValues(testTopic, "duplicate"))
+	if got := consume(); got != int64(len(stream)) {
+		t.Fatalf("redelivery: marked offset %d, want %d", got, len(stream))
+	}
+	if got := testutil.ToFloat64(metrics.KafkaMessagesFailed.WithLabelValues(testTopic, "save_error")); got != failed {
+		t.Errorf("redelivery produced %v save errors", got-failed)
+	}
+	if got := testutil.ToFloat64(metrics.KafkaMessagesFailed.WithLabelValues(testTopic, "duplicate")) - duplicates; got != float64(len(stream)) {
+		t.Errorf("redelivery counted %v duplicates, want %d", got, len(stream))
+	}
+
+	for uid, n := range audits {
+		records, err := db.GetOrderAudit(t.Context(), uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != n {
+			t.Errorf("order %s has %d audit records after redelivery, want %d", uid, len(records), n)
+		}
+	}
+	order, err := db.GetOrder(t.Context(), offsetUID(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Delivery.City != "Haifa" {
+		t.Errorf("updated city %q, want Haifa", order.Delivery.City)
+	}
+	order, err = db.GetOrder(t.Context(), offsetUID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.OrderStatusCancelled {
+		t.Errorf("cancelled order status %s", order.Status)
+	}
+}
@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"WB2/internal/cache"
+	"WB2/internal/decode"
+	"WB2/internal/service"
+	"WB2/internal/service/servicetest"
+
+	"github.com/IBM/sarama"
+)
+
+const testTopic = "orders"
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testOrderCreated - date_created заказов из testOrder
+var testOrderCreated = time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+
+// testOrder возвращает JSON валидного заказа uid
+func testOrder(t testing.TB, uid string) []byte {
+	t.Helper()
+	req := servicetest.NewCreateOrderRequest(uid)
+	req.DateCreated = &testOrderCreated
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testMessage - сообщение с заказом uid в партиции 0 по смещению offset
+func testMessage(t testing.TB, offset int64, uid string) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic: testTopic, Offset: offset, Key: []byte(uid), Value: testOrder(t, uid),
+		Headers: []*sarama.RecordHeader{{Key: []byte(decode.HeaderContentType), Value: []byte(decode.ContentTypeJSON)}},
+	}
+}
+
+// newTestConsumer собирает Consumer поверх group без брокеров
+func newTestConsumer(t testing.TB, orders *service.OrderService, group sarama.ConsumerGroup, claims claimConfig) *Consumer {
+	t.Helper()
+	decoders, err := decode.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Consumer{
+		log:      discardLog,
+		orders:   orders,
+		group:    group,
+		topics:   []string{testTopic},
+		state:    newConsumerState(),
+		claims:   claims,
+		decoders: decoders,
+		breaker:  newStorageBreaker(discardLog, 0, 0, nil),
+	}
+}
+
+// testHandler собирает обработчик сессии группы так же, как Consumer.consume
+func testHandler(c *Consumer) *consumerGroupHandler {
+	return &consumerGroupHandler{log: c.log, orders: c.orders, group: c.group, state: c.state, claims: c.claims,
+		decoders: c.decoders, breaker: c.breaker}
+}
+
+func newTestService(repo service.Repository) *service.OrderService {
+	return service.NewOrderService(repo, cache.NewOrderCache(time.Minute))
+}
+
+// fakeGroup - consumer group с одной партицией testTopic/0: сообщения берутся из messages,
+// отмеченные и зафиксированные смещения запоминаются
+type fakeGroup struct {
+	messages chan *sarama.ConsumerMessage
+	// onMark и onCommit вызываются при отметке и фиксации смещения; могут быть nil
+	onMark   func(next int64)
+	onCommit func(next int64)
+
+	mu        sync.Mutex
+	marked    int64
+	committed int64
+	closed    bool
+	pauses    int
+	resumes   int
+}
+
+func newFakeGroup(buffer int) *fakeGroup {
+	return &fakeGroup{messages: make(chan *sarama.ConsumerMessage, buffer)}
+}
+
+// Consume проводит одну сессию до отмены ctx, как sarama при остановке: Setup, ConsumeClaim, затем Cleanup
+func (g *fakeGroup) Consume(ctx context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	sessCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess := &fakeSession{ctx: sessCtx, group: g}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = handler.ConsumeClaim(sess, &fakeClaim{messages: g.messages})
+	}()
+	<-ctx.Done()
+	cancel()
+	<-done
+	return handler.Cleanup(sess)
+}
+
+func (g *fakeGroup) Errors() <-chan error { return nil }
+
+func (g *fakeGroup) Close() error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *fakeGroup) Pause(map[string][]int32)  {}
+func (g *fakeGroup) Resume(map[string][]int32) {}
+
+func (g *fakeGroup) PauseAll() {
+	g.mu.Lock()
+	g.pauses++
+	g.mu.Unlock()
+}
+
+func (g *fakeGroup) ResumeAll() {
+	g.mu.Lock()
+	g.resumes++
+	g.mu.Unlock()
+}
+
+func (g *fakeGroup) markedOffset() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.marked
+}
+
+func (g *fakeGroup) pauseCounts() (pauses, resumes int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pauses, g.resumes
+}
+
+type fakeSession struct {
+	ctx   context.Context
+	group *fakeGroup
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return map[string][]int32{testTopic: {0}} }
+func (s *fakeSession) MemberID() string           { return "test-member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) Context() context.Context   { return s.ctx }
+
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, _ string) {
+	if topic != testTopic || partition != 0 {
+		panic(fmt.Sprintf("unexpected partition %s/%d", topic, partition))
+	}
+	if s.group.onMark != nil {
+		s.group.onMark(offset)
+	}
+	s.group.mu.Lock()
+	s.group.marked = max(s.group.marked, offset)
+	s.group.mu.Unlock()
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+
+func (s *fakeSession) Commit() {
+	s.group.mu.Lock()
+	next := s.group.marked
+	s.group.committed = next
+	s.group.mu.Unlock()
+	if s.group.onCommit != nil {
+		s.group.onCommit(next)
+	}
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return testTopic }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(cap(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
@@ -0,0 +1,199 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"WB2/internal/config"
+
+	"github.com/IBM/sarama"
+)
+
+// ResetTarget - куда сдвинуть смещения группы
+type ResetTarget struct {
+	// Kind - earliest, latest, timestamp или offset
+	Kind string
+	// Time - для timestamp: первое сообщение не раньше этого момента
+	Time time.Time
+	// Offsets - для offset: смещение по номеру партиции
+	Offsets map[int32]int64
+}
+
+const (
+	ResetEarliest  = "earliest"
+	ResetLatest    = "latest"
+	ResetTimestamp = "timestamp"
+	ResetOffset    = "offset"
+)
+
+// PartitionOffset - текущее и новое смещение группы в партиции.
+// Current равно -1, если группа ещё не фиксировала смещение
+type PartitionOffset struct {
+	Partition int32
+	Current   int64
+	Target    int64
+}
+
+// OffsetResetter сдвигает зафиксированные смещения consumer group в топике
+type OffsetResetter struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+	group  string
+	topic  string
+}
+
+func NewOffsetResetter(kc config.Kafka) (*OffsetResetter, error) {
+	cfg, err := newClientConfig(kc)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(kc.Brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &OffsetResetter{client: client, admin: admin, group: kc.GroupID, topic: kc.Topic}, nil
+}
+
+// Close закрывает admin-клиент вместе с общим соединением
+func (r *OffsetResetter) Close() error { return r.admin.Close() }
+
+// Plan вычисляет новые смещения для партиций (пустой список - все партиции топика), ничего не меняя.
+// Новое смещение ограничивается диапазоном сообщений, которые есть в партиции; для timestamp без
+// сообщений после указанного момента берётся конец партиции
+func (r *OffsetResetter) Plan(target ResetTarget, partitions []int32) ([]PartitionOffset, error) {
+	all, err := r.client.Partitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions of %s: %w", r.topic, err)
+	}
+	if len(partitions) == 0 {
+		partitions = all
+	}
+	for _, p := range partitions {
+		if !slices.Contains(all, p) {
+			return nil, fmt.Errorf("topic %s has no partition %d", r.topic, p)
+		}
+	}
+	if target.Kind == ResetOffset {
+		for p := range target.Offsets {
+			if !slices.Contains(partitions, p) {
+				return nil, fmt.Errorf("offset given for partition %d which is not being reset", p)
+			}
+		}
+	}
+
+	committed, err := r.admin.ListConsumerGroupOffsets(r.group, map[string][]int32{r.topic: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("fetch offsets of group %s: %w", r.group, err)
+	}
+
+	plan := make([]PartitionOffset, 0, len(partitions))
+	for _, p := range partitions {
+		current := int64(-1)
+		if block := committed.GetBlock(r.topic, p); block != nil {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("fetch offset of partition %d: %w", p, block.Err)
+			}
+			current = block.Offset
+		}
+		oldest, err := r.client.GetOffset(r.topic, p, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("get oldest offset of partition %d: %w", p, err)
+		}
+		newest, err := r.client.GetOffset(r.topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("get newest offset of partition %d: %w", p, err)
+		}
+
+		var next int64
+		switch target.Kind {
+		case ResetEarliest:
+			next = oldest
+		case ResetLatest:
+			next = newest
+		case ResetTimestamp:
+			next, err = r.client.GetOffset(r.topic, p, target.Time.UnixMilli())
+			if err != nil {
+				return nil, fmt.Errorf("get offset of partition %d at %s: %w", p, target.Time.Format(time.RFC3339), err)
+			}
+			if next < 0 {
+				next = newest
+			}
+		case ResetOffset:
+			offset, ok := target.Offsets[p]
+			if !ok {
+				// партиция без явного смещения остаётся на месте
+				offset = current
+			}
+			next = offset
+		default:
+			return nil, fmt.Errorf("unknown reset target %q", target.Kind)
+		}
+		if next >= 0 {
+			next = min(max(next, oldest), newest)
+		}
+		plan = append(plan, PartitionOffset{Partition: p, Current: current, Target: next})
+	}
+	return plan, nil
+}
+
+// Apply фиксирует смещения из плана. Как и kafka-consumer-groups, сдвигать смещения можно только у группы
+// без активных участников: работающий consumer перезаписал бы их своими
+func (r *OffsetResetter) Apply(plan []PartitionOffset) error {
+	groups, err := r.admin.DescribeConsumerGroups([]string{r.group})
+	if err != nil {
+		return fmt.Errorf("describe group %s: %w", r.group, err)
+	}
+	for _, g := range groups {
+		if g.Err != sarama.ErrNoError {
+			return fmt.Errorf("describe group %s: %w", r.group, g.Err)
+		}
+		if g.State != "Empty" && g.State != "Dead" {
+			return fmt.Errorf("group %s is %s with %d members: stop the consumers before resetting offsets", r.group, g.State, len(g.Members))
+		}
+	}
+
+	// коммит от имени группы без участников: поколение -1, пустой member id
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           r.group,
+		ConsumerGroupGeneration: -1,
+		RetentionTime:           -1,
+	}
+	count := 0
+	for _, po := range plan {
+		if po.Target < 0 || po.Target == po.Current {
+			continue
+		}
+		req.AddBlock(r.topic, po.Partition, po.Target, 0, "")
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if err := r.client.RefreshCoordinator(r.group); err != nil {
+		return fmt.Errorf("find coordinator of group %s: %w", r.group, err)
+	}
+	coordinator, err := r.client.Coordinator(r.group)
+	if err != nil {
+		return fmt.Errorf("find coordinator of group %s: %w", r.group, err)
+	}
+	resp, err := coordinator.CommitOffset(req)
+	if err != nil {
+		return fmt.Errorf("commit offsets: %w", err)
+	}
+	var errs []error
+	for _, po := range plan {
+		if kerr := resp.Errors[r.topic][po.Partition]; kerr != sarama.ErrNoError {
+			errs = append(errs, fmt.Errorf("partition %d: %w", po.Partition, kerr))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,17 +3,26 @@ package kafka
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"time"
+
+	"WB2/internal/config"
+	"WB2/internal/decode"
+	"WB2/internal/tracing"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ProduceTestMessage отправляет в Kafka произвольный JSON заказа (как OrderResponse) для демонстрации
-func ProduceTestMessage(ctx context.Context, brokers []string, topic string, payload any) error {
-	cfg := sarama.NewConfig()
+// ProduceTestMessage отправляет в топик kc.Topic произвольный JSON заказа (как OrderResponse) для демонстрации.
+// key - order_uid заказа: сообщения одного заказа попадают в одну партицию и обрабатываются по порядку
+func ProduceTestMessage(ctx context.Context, kc config.Kafka, key string, payload any) error {
+	cfg, err := newClientConfig(kc)
+	if err != nil {
+		return err
+	}
 	cfg.Producer.Return.Successes = true
-	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	producer, err := sarama.NewSyncProducer(kc.Brokers, cfg)
 	if err != nil {
 		return err
 	}
@@ -23,11 +32,35 @@ func ProduceTestMessage(ctx context.Context, brokers []string, topic string, pay
 	if err != nil {
 		return err
 	}
+	topic := kc.Topic
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
-		Key:   sarama.StringEncoder(fmt.Sprintf("key-%d", time.Now().UnixNano())),
+		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(data),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(decode.HeaderContentType), Value: []byte(decode.ContentTypeJSON)},
+			{Key: []byte(decode.HeaderSchemaVersion), Value: []byte("1")},
+		},
+	}
+
+	// Спан отправки; его контекст уходит в заголовках, и consumer продолжает ту же трассу
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.produce "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", topic),
+		))
+	defer span.End()
+	tracing.InjectKafka(ctx, msg)
+
+	partition, offset, err := producer.SendMessage(msg)
+	if err != nil {
+		span.SetStatus(codes.Error, "send failed")
+		span.RecordError(err)
+		return err
 	}
-	_, _, err = producer.SendMessage(msg)
-	return err
+	span.SetAttributes(
+		attribute.Int("messaging.kafka.destination.partition", int(partition)),
+		attribute.Int64("messaging.kafka.message.offset", offset))
+	return nil
 }
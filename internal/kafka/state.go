@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"WB2/internal/health"
+)
+
+// consumerState - состояние consumer для проверки готовности; обновляется из Run и обработчика сессии
+type consumerState struct {
+	mu            sync.Mutex
+	running       bool
+	sessionActive bool
+	// lastProgress - время последнего обработанного сообщения или начала сессии
+	lastProgress time.Time
+	lastError    string
+	// paused - чтение приостановлено автоматом защиты хранилища с pausedSince
+	paused      bool
+	pausedSince time.Time
+	// lag - отставание по партициям текущей сессии ("topic/partition" -> сообщений)
+	lag map[string]int64
+	// now - часы состояния; в тестах подменяются
+	now func() time.Time
+}
+
+func newConsumerState() *consumerState {
+	return &consumerState{lag: make(map[string]int64), now: time.Now}
+}
+
+func (s *consumerState) setRunning(running bool) {
+	s.mu.Lock()
+	s.running = running
+	s.mu.Unlock()
+}
+
+func (s *consumerState) setError(err error) {
+	s.mu.Lock()
+	s.lastError = err.Error()
+	s.mu.Unlock()
+}
+
+// sessionStarted вызывается в Setup: назначение партиций сменилось, отставание считается заново
+func (s *consumerState) sessionStarted() {
+	s.mu.Lock()
+	s.sessionActive = true
+	s.lastProgress = s.now()
+	s.lag = make(map[string]int64)
+	s.mu.Unlock()
+}
+
+func (s *consumerState) sessionEnded() {
+	s.mu.Lock()
+	s.sessionActive = false
+	s.mu.Unlock()
+}
+
+func (s *consumerState) setLag(topic string, partition int32, lag int64) {
+	s.mu.Lock()
+	s.lag[topic+"/"+strconv.Itoa(int(partition))] = lag
+	s.mu.Unlock()
+}
+
+func (s *consumerState) setPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	if paused {
+		s.pausedSince = s.now()
+	}
+	s.mu.Unlock()
+}
+
+func (s *consumerState) progressed() {
+	s.mu.Lock()
+	s.lastProgress = s.now()
+	s.mu.Unlock()
+}
+
+// HealthCheck возвращает проверку готовности consumer: цикл чтения запущен, сессия группы активна,
+// чтение не приостановлено из-за недоступности БД, и при ненулевом отставании сообщения
+// обрабатывались не позже stallTimeout назад
+func (c *Consumer) HealthCheck(stallTimeout time.Duration) health.CheckFunc {
+	return func(context.Context) (map[string]any, error) {
+		s := c.state
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var totalLag int64
+		for _, l := range s.lag {
+			totalLag += l
+		}
+		details := map[string]any{
+			"running":        s.running,
+			"session_active": s.sessionActive,
+			"lag":            totalLag,
+			"partitions":     len(s.lag),
+			"paused":         s.paused,
+		}
+		if s.paused {
+			details["paused_since"] = s.pausedSince.UTC().Format(time.RFC3339)
+		}
+		if !s.lastProgress.IsZero() {
+			details["last_progress_at"] = s.lastProgress.UTC().Format(time.RFC3339)
+		}
+		if s.lastError != "" {
+			details["last_error"] = s.lastError
+		}
+
+		switch {
+		case !s.running:
+			return details, errors.New("consumer loop is not running")
+		case !s.sessionActive:
+			return details, errors.New("no active consumer group session")
+		case s.paused:
+			return details, fmt.Errorf("consumption paused for %s: storage is unavailable", s.now().Sub(s.pausedSince).Round(time.Second))
+		case totalLag > 0 && s.now().Sub(s.lastProgress) > stallTimeout:
+			return details, fmt.Errorf("no progress for %s with lag %d", s.now().Sub(s.lastProgress).Round(time.Second), totalLag)
+		}
+		return details, nil
+	}
+}
@@ -18,19 +18,22 @@ func SetupLogger(env string) *slog.Logger {
 	case "local":
 		log = slog.New(
 			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-				Level: slog.LevelDebug,
+				Level:       slog.LevelDebug,
+				ReplaceAttr: ReplaceAttr,
 			}),
 		)
 	case "dev":
 		log = slog.New(
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-				Level: slog.LevelDebug,
+				Level:       slog.LevelDebug,
+				ReplaceAttr: ReplaceAttr,
 			}),
 		)
 	case "prod":
 		log = slog.New(
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-				Level: slog.LevelInfo,
+				Level:       slog.LevelInfo,
+				ReplaceAttr: ReplaceAttr,
 			}),
 		)
 	}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// redacted - значение, которым заменяются персональные данные и секреты в логах
+const redacted = "[REDACTED]"
+
+// piiKeys - ключи атрибутов, значения которых не должны попадать в логи (сравнение без учёта регистра)
+var piiKeys = map[string]struct{}{
+	"name":          {},
+	"full_name":     {},
+	"phone":         {},
+	"email":         {},
+	"address":       {},
+	"delivery":      {},
+	"transaction":   {},
+	"bank":          {},
+	"password":      {},
+	"secret":        {},
+	"token":         {},
+	"api_key":       {},
+	"x-api-key":     {},
+	"authorization": {},
+}
+
+// ReplaceAttr - slog.HandlerOptions.ReplaceAttr, заменяющий значения PII-ключей (в том числе во вложенных группах)
+func ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if isPIIKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// isPIIKey проверяет ключ целиком и его последний сегмент ("delivery_phone", "delivery.email")
+func isPIIKey(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := piiKeys[key]; ok {
+		return true
+	}
+	if i := strings.LastIndexAny(key, "._"); i >= 0 {
+		_, ok := piiKeys[key[i+1:]]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Component - часть сервиса с управляемым запуском и остановкой.
+// Start не должен блокироваться: долгую работу компонент запускает в горутине.
+// Start и Stop необязательны
+type Component struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// StopResult - итог остановки одного компонента
+type StopResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// Manager запускает компоненты в порядке добавления (зависимости раньше зависимых)
+// и останавливает в обратном
+type Manager struct {
+	log        *slog.Logger
+	components []Component
+	// started - сколько компонентов из начала списка запущено
+	started int
+
+	failOnce sync.Once
+	failed   chan error
+}
+
+func NewManager(log *slog.Logger) *Manager {
+	return &Manager{log: log, failed: make(chan error, 1)}
+}
+
+// Add добавляет компонент; он зависит от всех добавленных раньше
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, c)
+}
+
+// Start запускает компоненты по порядку. При ошибке уже запущенные останавливаются
+// в обратном порядке, и ошибка возвращается
+func (m *Manager) Start(ctx context.Context) error {
+	for _, c := range m.components {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				err = fmt.Errorf("start %s: %w", c.Name, err)
+				m.Stop(context.WithoutCancel(ctx))
+				return err
+			}
+		}
+		m.started++
+		m.log.Debug("component started", slog.String("component", c.Name))
+	}
+	return nil
+}
+
+// Fail сообщает о фатальной ошибке компонента, работающего в фоне: Wait вернёт её,
+// и сервис начнёт остановку. Учитывается только первая ошибка
+func (m *Manager) Fail(name string, err error) {
+	m.failOnce.Do(func() {
+		m.failed <- fmt.Errorf("%s: %w", name, err)
+	})
+}
+
+// Wait блокируется до отмены ctx (например, по сигналу) или до вызова Fail
+func (m *Manager) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-m.failed:
+		return err
+	}
+}
+
+// Stop останавливает запущенные компоненты в обратном порядке, даже если часть остановок
+// завершилась ошибкой, и возвращает длительность остановки каждого. ctx ограничивает
+// общее время: компоненты, до которых очередь дошла после его истечения, получают уже
+// отменённый контекст и должны освободить ресурсы без ожидания
+func (m *Manager) Stop(ctx context.Context) []StopResult {
+	results := make([]StopResult, 0, m.started)
+	for i := m.started - 1; i >= 0; i-- {
+		c := m.components[i]
+		if c.Stop == nil {
+			continue
+		}
+		begin := time.Now()
+		err := c.Stop(ctx)
+		res := StopResult{Name: c.Name, Duration: time.Since(begin), Err: err}
+		results = append(results, res)
+
+		attrs := []any{slog.String("component", c.Name), slog.Duration("duration", res.Duration)}
+		if err != nil {
+			m.log.Error("component stop failed", append(attrs, slog.String("err", err.Error()))...)
+		} else {
+			m.log.Info("component stopped", attrs...)
+		}
+	}
+	m.started = 0
+	return results
+}
+
+// Err объединяет ошибки остановки компонентов
+func Err(results []StopResult) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
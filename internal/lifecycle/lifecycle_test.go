@@ -0,0 +1,129 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+func newTestManager() *Manager {
+	return NewManager(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// record возвращает компонент, который дописывает в log события своего запуска и остановки
+func record(log *[]string, name string, stopErr error) Component {
+	return Component{
+		Name:  name,
+		Start: func(context.Context) error { *log = append(*log, "start "+name); return nil },
+		Stop:  func(context.Context) error { *log = append(*log, "stop "+name); return stopErr },
+	}
+}
+
+func TestManagerStopsInReverseOrder(t *testing.T) {
+	var log []string
+	m := newTestManager()
+	m.Add(record(&log, "database", nil))
+	m.Add(Component{Name: "background", Start: func(context.Context) error { log = append(log, "start background"); return nil }})
+	m.Add(record(&log, "kafka_consumer", nil))
+	m.Add(record(&log, "http", nil))
+	if err := m.Start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	results := m.Stop(t.Context())
+
+	want := []string{"start database", "start background", "start kafka_consumer", "start http",
+		"stop http", "stop kafka_consumer", "stop database"}
+	if !slices.Equal(log, want) {
+		t.Fatalf("got %v, want %v", log, want)
+	}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	if !slices.Equal(names, []string{"http", "kafka_consumer", "database"}) {
+		t.Fatalf("results for %v, want the stopped components in stop order", names)
+	}
+	if err := Err(results); err != nil {
+		t.Fatal(err)
+	}
+	// повторная остановка ничего не делает
+	if results := m.Stop(t.Context()); len(results) != 0 {
+		t.Fatalf("second stop returned %v", results)
+	}
+}
+
+func TestManagerStartFailureStopsStarted(t *testing.T) {
+	var log []string
+	m := newTestManager()
+	m.Add(record(&log, "database", nil))
+	m.Add(record(&log, "kafka_consumer", nil))
+	boom := errors.New("boom")
+	m.Add(Component{Name: "http", Start: func(context.Context) error { return boom },
+		Stop: func(context.Context) error { log = append(log, "stop http"); return nil }})
+	m.Add(record(&log, "never", nil))
+
+	err := m.Start(t.Context())
+	if !errors.Is(err, boom) {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+	want := []string{"start database", "start kafka_consumer", "stop kafka_consumer", "stop database"}
+	if !slices.Equal(log, want) {
+		t.Fatalf("got %v, want %v", log, want)
+	}
+}
+
+func TestManagerStopContinuesAfterErrors(t *testing.T) {
+	var log []string
+	errDB, errHTTP := errors.New("close pool"), errors.New("shutdown timeout")
+	m := newTestManager()
+	m.Add(record(&log, "database", errDB))
+	m.Add(record(&log, "kafka_consumer", nil))
+	m.Add(record(&log, "http", errHTTP))
+	if err := m.Start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	err := Err(m.Stop(t.Context()))
+	if !slices.Contains(log, "stop database") {
+		t.Fatal("database was not stopped after http failed to stop")
+	}
+	if !errors.Is(err, errDB) || !errors.Is(err, errHTTP) {
+		t.Fatalf("got %v, want both stop errors", err)
+	}
+	if want := "http: shutdown timeout\ndatabase: close pool"; err.Error() != want {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+}
+
+func TestErr(t *testing.T) {
+	if err := Err(nil); err != nil {
+		t.Fatalf("no results: got %v", err)
+	}
+	if err := Err([]StopResult{{Name: "http"}, {Name: "database"}}); err != nil {
+		t.Fatalf("no errors: got %v", err)
+	}
+	boom := errors.New("boom")
+	err := Err([]StopResult{{Name: "http"}, {Name: "database", Err: boom}})
+	if !errors.Is(err, boom) || err.Error() != "database: boom" {
+		t.Fatalf("got %v, want database: boom", err)
+	}
+}
+
+func TestWaitReturnsFirstFailure(t *testing.T) {
+	m := newTestManager()
+	first := errors.New("listen failed")
+	m.Fail("http", first)
+	m.Fail("kafka_consumer", errors.New("ignored"))
+	err := m.Wait(context.Background())
+	if !errors.Is(err, first) || err.Error() != "http: listen failed" {
+		t.Fatalf("got %v, want the first failure", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newTestManager().Wait(ctx); err != nil {
+		t.Fatalf("cancelled wait: got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"WB2/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterCache публикует размер и счётчики кэша заказов; значения читаются из кэша при каждом scrape
+func RegisterCache(c *cache.OrderCache) {
+	stat := func(f func(cache.Stats) uint64) func() float64 {
+		return func() float64 { return float64(f(c.Stats())) }
+	}
+	Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "size",
+			Help: "Orders currently held in the cache.",
+		}, func() float64 { return float64(c.Len()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "hits_total",
+			Help: "Cache lookups that found an order.",
+		}, stat(func(s cache.Stats) uint64 { return s.Hits })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "misses_total",
+			Help: "Cache lookups that did not find an order (including expired).",
+		}, stat(func(s cache.Stats) uint64 { return s.Misses })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "evictions_total",
+			Help: "Orders removed from the cache because their TTL expired.",
+		}, stat(func(s cache.Stats) uint64 { return s.Evictions })),
+	)
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace - общий префикс метрик сервиса
+const namespace = "wb"
+
+// Registry - реестр метрик процесса; отдаётся на /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "GORM statement duration by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "GORM statements that returned an error (record not found excluded).",
+	}, []string{"operation", "table"})
+
+	KafkaMessagesProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_processed_total",
+		Help:      "Kafka messages successfully processed.",
+	}, []string{"topic"})
+
+	KafkaMessagesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_failed_total",
+		Help:      "Kafka messages that failed processing, by reason.",
+	}, []string{"topic", "reason"})
+
+	KafkaConsumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "consumer_lag",
+		Help:      "Messages between the last consumed offset and the partition high watermark.",
+	}, []string{"topic", "partition"})
+
+	KafkaRebalances = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "rebalances_total",
+		Help:      "Consumer group sessions started (one per rebalance).",
+	})
+
+	KafkaBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "batch_size",
+		Help:      "Orders written to the database in one consumer transaction.",
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	}, []string{"topic"})
+
+	KafkaBatchFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "batch_fallbacks_total",
+		Help:      "Consumer batches that failed as a whole and were saved record by record.",
+	}, []string{"topic"})
+
+	KafkaEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "events_total",
+		Help:      "Order events handled by the consumer, by type and outcome (applied, noop, stale, duplicate).",
+	}, []string{"topic", "type", "outcome"})
+
+	KafkaConsumerPaused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "consumer_paused",
+		Help:      "1 while the consumer has paused its partitions because the database is unavailable.",
+	})
+
+	KafkaBreakerTrips = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "breaker_trips_total",
+		Help:      "Times the storage circuit breaker opened and paused consumption.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		DBQueryDuration,
+		DBQueryErrors,
+		KafkaMessagesProcessed,
+		KafkaMessagesFailed,
+		KafkaConsumerLag,
+		KafkaRebalances,
+		KafkaBatchSize,
+		KafkaBatchFallbacks,
+		KafkaEvents,
+		KafkaConsumerPaused,
+		KafkaBreakerTrips,
+	)
+}
+
+// Handler отдаёт метрики реестра в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
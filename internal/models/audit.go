@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// AuditAction - тип операции над сущностью заказа
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+	// AuditActionErase - обезличивание персональных данных по запросу клиента
+	AuditActionErase AuditAction = "erase"
+)
+
+// AuditEntity - сущность агрегата заказа, к которой относится запись журнала
+type AuditEntity string
+
+const (
+	AuditEntityOrder    AuditEntity = "order"
+	AuditEntityDelivery AuditEntity = "delivery"
+	AuditEntityPayment  AuditEntity = "payment"
+	AuditEntityItem     AuditEntity = "item"
+)
+
+// OrderAudit - запись append-only журнала изменений заказа.
+// Before/After - JSON-снимки сущности до и после операции, Diff - изменившиеся поля.
+// Снимки содержат персональные данные, поэтому хранятся зашифрованными
+type OrderAudit struct {
+	ID        uint        `gorm:"primaryKey"`
+	OrderUID  string      `gorm:"not null;index"`
+	Entity    AuditEntity `gorm:"type:varchar(16);not null"`
+	EntityID  uint        `gorm:"not null"`
+	Action    AuditAction `gorm:"type:varchar(16);not null"`
+	Actor     string      `gorm:"not null"`
+	Before    string      `gorm:"type:text;serializer:encrypted"`
+	After     string      `gorm:"type:text;serializer:encrypted"`
+	Diff      string      `gorm:"type:text;serializer:encrypted"`
+	CreatedAt time.Time   `gorm:"index"`
+}
+
+// TableName - имя таблицы журнала изменений
+func (OrderAudit) TableName() string {
+	return "order_audit"
+}
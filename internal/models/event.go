@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// OrderEvent - обработанное событие заказа из Kafka. По EventID повторная доставка события распознаётся
+// как дубликат, по OccurredAt отбрасываются события, которые пришли позже более новых того же вида.
+// События order.created не записываются: их повторы распознаются по order_uid
+type OrderEvent struct {
+	EventID  string `gorm:"primaryKey;size:255"`
+	OrderUID string `gorm:"not null;index:idx_order_events_stream"`
+	Type     string `gorm:"type:varchar(64);not null;index:idx_order_events_stream"`
+	// Subject - объект внутри заказа (rid товара), пусто для событий всего заказа
+	Subject    string `gorm:"index:idx_order_events_stream"`
+	OccurredAt time.Time
+	// Outcome - чем закончилась обработка: applied, noop (заказ уже в нужном состоянии) или stale
+	Outcome   string `gorm:"type:varchar(16);not null"`
+	CreatedAt time.Time
+}
+
+// Результаты обработки события заказа
+const (
+	EventApplied = "applied"
+	// EventNoop - заказ уже в состоянии, к которому ведёт событие (например, уже отменён)
+	EventNoop = "noop"
+	// EventStale - событие старше уже применённого события того же вида
+	EventStale = "stale"
+	// EventDuplicate - событие уже обработано; в журнал повторно не пишется
+	EventDuplicate = "duplicate"
+)
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// OrderFilter - условия отбора заказов для списка и выгрузки
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	// Phone и Email - поиск по данным получателя (через blind index)
+	Phone       string
+	Email       string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// IsEmpty сообщает, что фильтр не задан ни одним условием
+func (f OrderFilter) IsEmpty() bool {
+	return f.CustomerID == "" && f.TrackNumber == "" && f.DeliveryService == "" && f.Phone == "" && f.Email == "" && f.CreatedFrom == nil && f.CreatedTo == nil
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyKey - сохранённый результат запроса с заголовком Idempotency-Key.
+// StatusCode == 0 означает, что запрос с этим ключом ещё обрабатывается. Body (ответ с данными заказа) хранится зашифрованным
+type IdempotencyKey struct {
+	Key         string `gorm:"column:idempotency_key;primaryKey;size:255"`
+	Fingerprint string `gorm:"not null"`
+	StatusCode  int
+	ContentType string
+	Body        []byte `gorm:"type:bytea;serializer:encrypted"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// InProgress сообщает, что ответ по ключу ещё не сохранён
+func (k *IdempotencyKey) InProgress() bool {
+	return k.StatusCode == 0
+}
@@ -3,13 +3,16 @@ package models
 import (
 	"time"
 
+	"WB2/internal/encryption"
+
 	"gorm.io/gorm"
 )
 
 // Order - основная модель заказа
 type Order struct {
 	gorm.Model
-	OrderUID          string `gorm:"not null"`
+	OrderUID          string      `gorm:"not null"`
+	Status            OrderStatus `gorm:"type:varchar(32);not null;default:'new';index"`
 	TrackNumber       string
 	Entry             string
 	Delivery          Delivery `gorm:"foreignKey:OrderID"`
@@ -25,33 +28,38 @@ type Order struct {
 	OofShard          string
 }
 
-// Delivery - модель доставки
+// Delivery - модель доставки.
+// Phone, Email и Address хранятся зашифрованными; поиск по телефону и почте идёт по blind index (PhoneHash, EmailHash)
 type Delivery struct {
 	gorm.Model
-	OrderID uint `gorm:"not null"`
-	Name    string
-	Phone   string
-	Zip     string
-	City    string
-	Address string
-	Region  string
-	Email   string
+	OrderID   uint `gorm:"not null"`
+	Name      string
+	Phone     string `gorm:"serializer:encrypted"`
+	Zip       string
+	City      string
+	Address   string `gorm:"serializer:encrypted"`
+	Region    string
+	Email     string `gorm:"serializer:encrypted"`
+	PhoneHash string `gorm:"size:64;index"`
+	EmailHash string `gorm:"size:64;index"`
 }
 
-// Payment - модель платежа
+// Payment - модель платежа.
+// Transaction и Bank хранятся зашифрованными; поиск по транзакции идёт по TransactionHash
 type Payment struct {
 	gorm.Model
-	OrderID      uint
-	Transaction  string
-	RequestID    string
-	Currency     string
-	Provider     string
-	Amount       int
-	PaymentDt    int64
-	Bank         string
-	DeliveryCost int
-	GoodsTotal   int
-	CustomFee    int
+	OrderID         uint
+	Transaction     string `gorm:"serializer:encrypted"`
+	RequestID       string
+	Currency        string
+	Provider        string
+	Amount          int
+	PaymentDt       int64
+	Bank            string `gorm:"serializer:encrypted"`
+	DeliveryCost    int
+	GoodsTotal      int
+	CustomFee       int
+	TransactionHash string `gorm:"size:64;index"`
 }
 
 // Item - модель товара в заказе
@@ -68,5 +76,65 @@ type Item struct {
 	TotalPrice  int
 	NmID        int
 	Brand       string
-	Status      int
+	Status      ItemStatus
+}
+
+// BeforeCreate проставляет начальный статус заказу, созданному без статуса
+func (o *Order) BeforeCreate(tx *gorm.DB) error {
+	if o.Status == "" {
+		o.Status = OrderStatusNew
+	}
+	return nil
+}
+
+// ErasedName - имя получателя после обезличивания
+const ErasedName = "[erased]"
+
+// Anonymize удаляет персональные данные получателя; город и регион остаются для статистики
+func (d *Delivery) Anonymize() {
+	d.Name = ErasedName
+	d.Phone = ""
+	d.Email = ""
+	d.Address = ""
+	d.Zip = ""
+	d.SetBlindIndexes()
+}
+
+// SetBlindIndexes пересчитывает хеши для поиска по зашифрованным телефону и почте
+func (d *Delivery) SetBlindIndexes() {
+	d.PhoneHash = encryption.BlindIndex(encryption.NormalizePhone(d.Phone))
+	d.EmailHash = encryption.BlindIndex(encryption.NormalizeEmail(d.Email))
+}
+
+// BeforeSave обновляет blind index перед каждой записью доставки
+func (d *Delivery) BeforeSave(tx *gorm.DB) error {
+	d.SetBlindIndexes()
+	return nil
+}
+
+// SetBlindIndexes пересчитывает хеш для поиска по зашифрованной транзакции
+func (p *Payment) SetBlindIndexes() {
+	p.TransactionHash = encryption.BlindIndex(p.Transaction)
+}
+
+// BeforeSave обновляет blind index перед каждой записью платежа
+func (p *Payment) BeforeSave(tx *gorm.DB) error {
+	p.SetBlindIndexes()
+	return nil
+}
+
+// OrderStatusHistory - запись о смене статуса заказа
+type OrderStatusHistory struct {
+	ID         uint        `gorm:"primaryKey"`
+	OrderID    uint        `gorm:"not null;index"`
+	OrderUID   string      `gorm:"not null;index"`
+	FromStatus OrderStatus `gorm:"type:varchar(32);not null"`
+	ToStatus   OrderStatus `gorm:"type:varchar(32);not null"`
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// TableName - имя таблицы истории статусов
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RateLimitBucket - состояние корзины token bucket для общего (между репликами) rate limiting
+type RateLimitBucket struct {
+	Key       string `gorm:"column:bucket_key;primaryKey;size:512"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+	// IdleAfter - время, после которого корзина гарантированно полна и её можно удалить
+	IdleAfter time.Time `gorm:"index"`
+}
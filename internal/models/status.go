@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIllegalTransition - переход между статусами заказа не разрешён таблицей переходов
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// OrderStatus - статус жизненного цикла заказа
+type OrderStatus string
+
+const (
+	OrderStatusNew        OrderStatus = "new"
+	OrderStatusPaid       OrderStatus = "paid"
+	OrderStatusAssembling OrderStatus = "assembling"
+	OrderStatusShipped    OrderStatus = "shipped"
+	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusReturned   OrderStatus = "returned"
+)
+
+// orderTransitions - разрешённые переходы: из статуса-ключа в любой из статусов-значений.
+// cancelled и returned - конечные статусы
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:       {OrderStatusAssembling, OrderStatusCancelled},
+	OrderStatusAssembling: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered, OrderStatusReturned},
+	OrderStatusDelivered:  {OrderStatusReturned},
+	OrderStatusCancelled:  {},
+	OrderStatusReturned:   {},
+}
+
+// ParseOrderStatus проверяет, что строка - известный статус заказа
+func ParseOrderStatus(s string) (OrderStatus, error) {
+	st := OrderStatus(s)
+	if _, ok := orderTransitions[st]; !ok {
+		return "", fmt.Errorf("unknown order status %q", s)
+	}
+	return st, nil
+}
+
+// AllowedTransitions возвращает статусы, в которые можно перейти из текущего
+func (s OrderStatus) AllowedTransitions() []OrderStatus {
+	return orderTransitions[s]
+}
+
+// CanTransitionTo сообщает, разрешён ли переход из s в to
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemStatus - код статуса товара в заказе, как его передаёт источник данных. Набор кодов задаёт
+// источник и сервисом не ограничивается: известна только семантика 202, остальные коды
+// сохраняются и отдаются как есть
+type ItemStatus int
+
+// ItemStatusAccepted - код из исходных данных (товар принят в обработку)
+const ItemStatusAccepted ItemStatus = 202
+
+var itemStatusNames = map[ItemStatus]string{
+	ItemStatusAccepted: "accepted",
+}
+
+// Name возвращает имя статуса товара или пустую строку, если семантика кода неизвестна
+func (s ItemStatus) Name() string {
+	return itemStatusNames[s]
+}
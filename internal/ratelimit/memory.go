@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"WB2/internal/config"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// idleAfter - время, после которого корзина гарантированно полна и её можно удалить
+	idleAfter time.Time
+}
+
+// Memory хранит корзины в памяти процесса: лимиты действуют в пределах одной реплики
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) Take(_ context.Context, key string, limit config.Limit) (bool, time.Duration, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	tokens, allowed, wait := Refill(b.tokens, b.last, now, limit)
+	b.tokens, b.last, b.idleAfter = tokens, now, IdleAfter(now, limit)
+	return allowed, wait, nil
+}
+
+// StartCleaner периодически удаляет корзины неактивных клиентов, чтобы память не росла с числом ключей
+func (m *Memory) StartCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				m.mu.Lock()
+				for key, b := range m.buckets {
+					if now.After(b.idleAfter) {
+						delete(m.buckets, key)
+					}
+				}
+				m.mu.Unlock()
+			}
+		}
+	}()
+}
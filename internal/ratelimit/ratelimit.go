@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"WB2/internal/config"
+)
+
+// Limiter - token bucket с корзиной на каждый ключ
+type Limiter interface {
+	// Take забирает токен из корзины key. Если токенов нет, возвращает false и время до появления следующего
+	Take(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error)
+}
+
+// Cleaner - Limiter, которому нужна фоновая очистка корзин неактивных клиентов
+type Cleaner interface {
+	StartCleaner(ctx context.Context, interval time.Duration)
+}
+
+// New создаёт Limiter для бэкенда из конфигурации; log нужен фоновой очистке общих корзин
+func New(log *slog.Logger, cfg config.RateLimit, shared Store) (Limiter, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "postgres":
+		if shared == nil {
+			return nil, fmt.Errorf("rate_limit: postgres backend requires storage")
+		}
+		return NewShared(log, shared), nil
+	}
+	return nil, fmt.Errorf("rate_limit: unknown backend %q", cfg.Backend)
+}
+
+// Refill пополняет корзину за прошедшее время и пытается забрать токен.
+// Возвращает новое число токенов, результат и время ожидания следующего токена
+func Refill(tokens float64, last, now time.Time, limit config.Limit) (float64, bool, time.Duration) {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.RPS)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	if limit.RPS <= 0 {
+		return tokens, false, time.Hour
+	}
+	wait := time.Duration((1 - tokens) / limit.RPS * float64(time.Second))
+	return tokens, false, wait
+}
+
+// IdleAfter возвращает время, после которого корзина, тронутая в now, гарантированно полна:
+// удалить её тогда - то же, что завести заново
+func IdleAfter(now time.Time, limit config.Limit) time.Time {
+	if limit.RPS <= 0 {
+		return now.Add(time.Hour)
+	}
+	return now.Add(time.Duration(float64(limit.Burst) / limit.RPS * float64(time.Second)))
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"WB2/internal/config"
+	"WB2/internal/lib/logger"
+)
+
+// Store - общее хранилище корзин (например, PostgreSQL), доступное всем репликам
+type Store interface {
+	TakeRateLimitToken(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error)
+	// DeleteIdleRateLimitBuckets удаляет корзины, полные к моменту now
+	DeleteIdleRateLimitBuckets(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Shared хранит корзины во внешнем хранилище, поэтому лимиты соблюдаются суммарно по всем репликам
+type Shared struct {
+	log   *slog.Logger
+	store Store
+}
+
+func NewShared(log *slog.Logger, store Store) *Shared {
+	return &Shared{log: log, store: store}
+}
+
+func (s *Shared) Take(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error) {
+	return s.store.TakeRateLimitToken(ctx, key, limit)
+}
+
+// StartCleaner периодически удаляет из хранилища корзины неактивных клиентов, чтобы таблица не росла с числом ключей
+func (s *Shared) StartCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if _, err := s.store.DeleteIdleRateLimitBuckets(ctx, now); err != nil && ctx.Err() == nil {
+					s.log.Warn("rate limit buckets cleanup failed", logger.Err(err))
+				}
+			}
+		}
+	}()
+}
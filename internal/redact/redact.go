@@ -0,0 +1,128 @@
+package redact
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"WB2/internal/auth"
+	"WB2/internal/models"
+)
+
+// Level - степень маскирования персональных данных получателя
+type Level int
+
+const (
+	// None - данные выдаются как есть
+	None Level = iota
+	// Partial - остаются фрагменты, достаточные для сверки: имя и инициал фамилии, последние цифры телефона, домен почты
+	Partial
+	// Full - остаются только инициалы и домен почты
+	Full
+)
+
+// Маскируемые поля доставки (имена как в JSON-ответах)
+const (
+	FieldName    = "name"
+	FieldPhone   = "phone"
+	FieldEmail   = "email"
+	FieldAddress = "address"
+)
+
+// mask - замена скрытой части значения
+const mask = "***"
+
+// phoneVisibleDigits - сколько последних цифр телефона видно при частичном маскировании
+const phoneVisibleDigits = 4
+
+// LevelFor возвращает степень маскирования для роли: admin видит данные полностью, writer - частично, остальные - маскированными
+func LevelFor(role auth.Role) Level {
+	switch role {
+	case auth.RoleAdmin:
+		return None
+	case auth.RoleWriter:
+		return Partial
+	}
+	return Full
+}
+
+// IsField сообщает, что поле доставки содержит персональные данные
+func IsField(field string) bool {
+	switch field {
+	case FieldName, FieldPhone, FieldEmail, FieldAddress:
+		return true
+	}
+	return false
+}
+
+// Value маскирует значение поля доставки; значения прочих полей возвращаются без изменений
+func Value(field, v string, level Level) string {
+	if level == None || v == "" {
+		return v
+	}
+	switch field {
+	case FieldName:
+		return name(v, level)
+	case FieldPhone:
+		return phone(v, level)
+	case FieldEmail:
+		return email(v, level)
+	case FieldAddress:
+		return mask
+	}
+	return v
+}
+
+// AnyValue маскирует значение поля из JSON-снимка или diff; нестроковые значения возвращаются без изменений
+func AnyValue(field string, v any, level Level) any {
+	if s, ok := v.(string); ok {
+		return Value(field, s, level)
+	}
+	return v
+}
+
+// Delivery маскирует персональные данные доставки на месте
+func Delivery(d *models.Delivery, level Level) {
+	d.Name = Value(FieldName, d.Name, level)
+	d.Phone = Value(FieldPhone, d.Phone, level)
+	d.Email = Value(FieldEmail, d.Email, level)
+	d.Address = Value(FieldAddress, d.Address, level)
+}
+
+// name: "Иван Петров" -> "Иван П." (Partial) или "И. П." (Full)
+func name(v string, level Level) string {
+	parts := strings.Fields(v)
+	for i, p := range parts {
+		if i == 0 && level == Partial {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(p)
+		parts[i] = string(r) + "."
+	}
+	return strings.Join(parts, " ")
+}
+
+// phone: "+79001234567" -> "+*******4567" (Partial) или "***" (Full)
+func phone(v string, level Level) string {
+	if level == Full || len(v) <= phoneVisibleDigits {
+		return mask
+	}
+	visible := v[len(v)-phoneVisibleDigits:]
+	prefix := ""
+	if strings.HasPrefix(v, "+") {
+		prefix = "+"
+	}
+	return prefix + strings.Repeat("*", len(v)-len(prefix)-phoneVisibleDigits) + visible
+}
+
+// email: "ivan@mail.ru" -> "i***@mail.ru" (Partial) или "***@mail.ru" (Full)
+func email(v string, level Level) string {
+	at := strings.LastIndexByte(v, '@')
+	if at < 0 {
+		return mask
+	}
+	if level == Full || at == 0 {
+		return mask + v[at:]
+	}
+	r, _ := utf8.DecodeRuneInString(v)
+	return string(r) + mask + v[at:]
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"WB2/internal/audit"
+	"WB2/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AuthMiddleware определяет клиента запроса и кладёт его в контекст (для RequireRole, логов и журнала изменений).
+// authenticator == nil означает, что аутентификация выключена и все запросы выполняются от anonymous
+func AuthMiddleware(log *slog.Logger, authenticator auth.Authenticator, anonymous *auth.Principal) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := anonymous
+			if authenticator != nil {
+				var err error
+				p, err = authenticator.Authenticate(c.Request())
+				if err != nil {
+					if !errors.Is(err, auth.ErrNoCredentials) {
+						log.Warn("authentication failed", slog.String("path", c.Path()), slog.String("ip", c.RealIP()), slog.String("reason", err.Error()))
+					}
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer, ApiKey header="`+auth.HeaderAPIKey+`"`)
+					return echo.NewHTTPError(http.StatusUnauthorized, "valid API key or bearer token is required")
+				}
+			}
+			ctx := auth.WithPrincipal(c.Request().Context(), p)
+			ctx = audit.WithActor(ctx, p.Actor())
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// RequireRole пропускает запрос, только если роль клиента не ниже required
+func RequireRole(required auth.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := auth.FromContext(c.Request().Context())
+			if !ok || !p.Role.Allows(required) {
+				return echo.NewHTTPError(http.StatusForbidden, "role "+string(required)+" is required")
+			}
+			return next(c)
+		}
+	}
+}
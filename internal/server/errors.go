@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"WB2/internal/apperr"
+	"WB2/internal/dto/response"
+	"WB2/internal/lib/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// statusByKind - HTTP-статус для каждой категории доменных ошибок
+var statusByKind = []struct {
+	kind   error
+	status int
+}{
+	{apperr.ErrBadRequest, http.StatusBadRequest},
+	{apperr.ErrNotFound, http.StatusNotFound},
+	{apperr.ErrConflict, http.StatusConflict},
+	{apperr.ErrValidation, http.StatusUnprocessableEntity},
+	{apperr.ErrUnavailable, http.StatusServiceUnavailable},
+}
+
+// toProblem переводит ошибку обработчика в ответ RFC 7807. Тексты неизвестных ошибок
+// (в том числе SQL) клиенту не отдаются: они попадают только в лог запроса
+func toProblem(err error) response.Problem {
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		p := response.Problem{Status: http.StatusInternalServerError, Code: appErr.Code, Detail: appErr.Message, Errors: appErr.Fields}
+		for _, m := range statusByKind {
+			if errors.Is(appErr.Kind, m.kind) {
+				p.Status = m.status
+				break
+			}
+		}
+		return p
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		p := response.Problem{Status: he.Code, Code: statusCode(he.Code)}
+		if he.Code < http.StatusInternalServerError {
+			p.Detail = fmt.Sprint(he.Message)
+		}
+		return p
+	}
+	if apperr.IsUnavailable(err) {
+		return response.Problem{Status: http.StatusServiceUnavailable, Code: "storage_unavailable", Detail: "storage is temporarily unavailable"}
+	}
+	return response.Problem{Status: http.StatusInternalServerError, Code: "internal_error", Detail: "internal server error"}
+}
+
+// statusCode - машиночитаемый код по HTTP-статусу: "Too Many Requests" -> "too_many_requests"
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// HTTPErrorHandler отдаёт все ошибки обработчиков и middleware в формате application/problem+json
+func HTTPErrorHandler(log *slog.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		p := toProblem(err)
+		p.Type = "about:blank"
+		p.Title = http.StatusText(p.Status)
+		p.Instance = c.Request().URL.Path
+
+		var writeErr error
+		if c.Request().Method == http.MethodHead {
+			writeErr = c.NoContent(p.Status)
+		} else {
+			// c.JSON не перезаписывает уже выставленный Content-Type
+			c.Response().Header().Set(echo.HeaderContentType, response.ContentTypeProblem)
+			writeErr = c.JSON(p.Status, p)
+		}
+		if writeErr != nil {
+			log.Error("failed to write error response", logger.Err(writeErr))
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"WB2/internal/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// livez - процесс жив и обслуживает HTTP; зависимости не проверяются, чтобы их сбой не приводил к перезапуску
+func livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]health.Status{"status": health.StatusUp})
+}
+
+// readyz проверяет зависимости; 503, если хотя бы один компонент не готов
+func readyz(checker *health.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := checker.Check(c.Request().Context())
+		code := http.StatusOK
+		if report.Status != health.StatusUp {
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, report)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/audit"
+	"WB2/internal/lib/logger"
+	storage "WB2/internal/storage/postgres"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderIdempotencyKey - заголовок с клиентским ключом идемпотентности
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed - выставляется на ответ, повторно отданный из сохранённого результата
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// responseRecorder дублирует тело ответа в буфер, чтобы сохранить его для повторов
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware обеспечивает идемпотентность запросов с заголовком Idempotency-Key:
+// повтор с тем же телом получает сохранённый ответ, повтор с другим телом - 422,
+// параллельный повтор, пока первый запрос обрабатывается, - 409
+func IdempotencyMiddleware(log *slog.Logger, store *storage.Storage, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				return apperr.BadRequest("idempotency_key_invalid", HeaderIdempotencyKey+" is too long")
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return apperr.BadRequest("bad_request", "failed to read request body").WithCause(err)
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(c.Request().Method, c.Path(), body)
+
+			ctx := c.Request().Context()
+			// Ключи разных клиентов не пересекаются: в БД хранится хэш ключа вместе с клиентом запроса
+			key = scopedIdempotencyKey(audit.ActorFromContext(ctx), key)
+			existing, err := store.ReserveIdempotencyKey(ctx, key, fingerprint, ttl)
+			if err != nil {
+				return apperr.FromStorage(fmt.Errorf("reserve idempotency key: %w", err), nil, nil)
+			}
+			if existing != nil {
+				if existing.Fingerprint != fingerprint {
+					return &apperr.Error{
+						Kind:    apperr.ErrValidation,
+						Code:    "idempotency_key_reused",
+						Message: HeaderIdempotencyKey + " was already used with a different request body"}
+				}
+				if existing.InProgress() {
+					return apperr.Conflict("idempotency_in_progress", "request with this "+HeaderIdempotencyKey+" is still being processed")
+				}
+				c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+				return c.Blob(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+
+			rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// Серверные ошибки не закрепляем за ключом: клиент должен иметь возможность повторить запрос.
+			// Используем отдельный контекст, чтобы запись результата не оборвалась вместе с запросом
+			saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				if err := store.ReleaseIdempotencyKey(saveCtx, key); err != nil {
+					log.Error("failed to release idempotency key", logger.Err(err))
+				}
+				return nil
+			}
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if err := store.CompleteIdempotencyKey(saveCtx, key, status, contentType, rec.body.Bytes()); err != nil {
+				log.Error("failed to save idempotent response", logger.Err(err))
+			}
+			return nil
+		}
+	}
+}
+
+// requestFingerprint - отпечаток запроса: метод, маршрут и тело
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scopedIdempotencyKey - ключ идемпотентности в пределах одного клиента
+func scopedIdempotencyKey(actor, key string) string {
+	sum := sha256.Sum256([]byte(actor + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
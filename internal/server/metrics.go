@@ -0,0 +1,33 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"WB2/internal/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MetricsMiddleware измеряет длительность запросов. Маршрут берётся шаблоном Echo ("/order/:id"),
+// чтобы число рядов не росло с числом заказов; запросы мимо маршрутов учитываются как "unmatched"
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			// ошибка ещё не записана в ответ: её обработает HTTPErrorHandler после middleware
+			if err != nil {
+				status = toProblem(err).Status
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.HTTPRequestDuration.WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
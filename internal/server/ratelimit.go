@@ -0,0 +1,53 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"WB2/internal/auth"
+	"WB2/internal/config"
+	"WB2/internal/lib/logger"
+	"WB2/internal/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitMiddleware ограничивает частоту запросов клиента по token bucket.
+// Корзина выбирается по клиенту (API-ключ или субъект токена, иначе IP) и маршруту; при исчерпании - 429 с Retry-After.
+// Ошибка хранилища лимитов не блокирует запросы (fail open)
+func RateLimitMiddleware(log *slog.Logger, limiter ratelimit.Limiter, cfg config.RateLimit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := c.Request().Method + " " + c.Path()
+			limit, ok := cfg.Routes[route]
+			if !ok {
+				limit = cfg.Default
+			}
+			if limit.RPS <= 0 || limit.Burst <= 0 {
+				return next(c)
+			}
+
+			allowed, wait, err := limiter.Take(c.Request().Context(), rateLimitClient(c)+"|"+route, limit)
+			if err != nil {
+				log.Error("rate limiter failed", slog.String("route", route), logger.Err(err))
+				return next(c)
+			}
+			if !allowed {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests, retry later")
+			}
+			return next(c)
+		}
+	}
+}
+
+// rateLimitClient - ключ клиента для rate limiting: аутентифицированный клиент либо IP-адрес
+func rateLimitClient(c echo.Context) string {
+	if p, ok := auth.FromContext(c.Request().Context()); ok && p.Method != "none" {
+		return "principal:" + p.Actor()
+	}
+	return "ip:" + c.RealIP()
+}
@@ -4,36 +4,78 @@ import (
 	"log/slog"
 	"net/http"
 
+	"WB2/internal/auth"
 	"WB2/internal/cache"
 	"WB2/internal/config"
 	"WB2/internal/handler"
+	"WB2/internal/health"
+	"WB2/internal/metrics"
+	"WB2/internal/ratelimit"
+	"WB2/internal/service"
 	storage "WB2/internal/storage/postgres"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
-// InitRoutes настраивает HTTP-маршруты приложения
-func InitRoutes(router *echo.Echo, log *slog.Logger, storage *storage.Storage, cfg *config.Config, c *cache.OrderCache) {
+// InitRoutes настраивает HTTP-маршруты приложения.
+// authenticator == nil отключает аутентификацию: все запросы выполняются от анонимного клиента
+// с ролью auth.anonymous_role (по умолчанию только чтение);
+// limiter == nil отключает rate limiting
+func InitRoutes(router *echo.Echo, log *slog.Logger, storage *storage.Storage, cfg *config.Config, c *cache.OrderCache, orderService *service.OrderService, authenticator auth.Authenticator, limiter ratelimit.Limiter, checker *health.Checker) {
 
-	router.Use(middleware.Logger())
+	// Ошибки обработчиков и middleware отдаются единообразно в формате RFC 7807
+	router.HTTPErrorHandler = HTTPErrorHandler(log)
+
+	// Спан на каждый запрос; контекст трассы (traceparent) принимается из заголовков клиента
+	router.Use(otelecho.Middleware(cfg.Tracing.ServiceName))
+	router.Use(requestLogger(log))
 	router.Use(middleware.Recover())
+	router.Use(MetricsMiddleware())
 	router.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"http://localhost:3000"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, auth.HeaderAPIKey, HeaderIdempotencyKey},
 		AllowMethods: []string{"GET", "HEAD", "PUT", "PATCH", "POST", "DELETE"},
 	}))
 
-	h := handler.NewHandler(log, storage, c)
+	h := handler.NewHandler(log, orderService)
+
+	reader := RequireRole(auth.RoleReader)
+	writer := RequireRole(auth.RoleWriter)
+	admin := RequireRole(auth.RoleAdmin)
+	idempotency := IdempotencyMiddleware(log, storage, cfg.Idempotency.TTL)
 
-	router.GET("/order", h.GetAllOrdres)
-	router.GET("/order/:id", h.GetOrderByID)
-	router.POST("/order", h.CreateOrder)
-	router.PUT("/order", h.UpdateOrder)
-	router.DELETE("/order", h.DeleteOrder)
+	anonymous := auth.Anonymous(auth.Role(cfg.Auth.AnonymousRole))
+	orders := router.Group("/order", AuthMiddleware(log, authenticator, anonymous))
+	customers := router.Group("/customer", AuthMiddleware(log, authenticator, anonymous))
+	if limiter != nil {
+		orders.Use(RateLimitMiddleware(log, limiter, cfg.RateLimit))
+		customers.Use(RateLimitMiddleware(log, limiter, cfg.RateLimit))
+	}
+	orders.GET("", h.GetAllOrdres, reader)
+	orders.GET("/export", h.ExportOrders, reader)
+	orders.GET("/:id", h.GetOrderByID, reader)
+	orders.POST("", h.CreateOrder, writer, idempotency)
+	orders.POST("/batch", h.CreateOrdersBatch, writer, idempotency)
+	orders.PUT("", h.UpdateOrder, writer)
+	orders.GET("/:id/history", h.GetOrderHistory, reader)
+	orders.GET("/:id/diff", h.GetOrderDiff, reader)
+	orders.GET("/:id/transitions", h.GetOrderTransitions, reader)
+	orders.POST("/:id/transitions", h.TransitionOrder, writer)
+	orders.DELETE("", h.DeleteOrder, admin)
 
-	// healthcheck
+	// Запросы клиентов на выгрузку и удаление персональных данных
+	customers.GET("/:id/data-export", h.ExportCustomerData, admin)
+	customers.POST("/:id/erase", h.EraseCustomerData, admin)
+
+	// healthcheck; /health оставлен для совместимости, для проб - /livez и /readyz
 	router.GET("/health", func(c echo.Context) error { return c.JSON(200, map[string]string{"status": "ok"}) })
+	router.GET("/livez", livez)
+	router.GET("/readyz", readyz(checker))
+
+	// Метрики Prometheus
+	router.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 
 	// Swagger UI (через CDN) и статическая раздача OpenAPI файла
 	router.GET("/openapi.yaml", func(c echo.Context) error { return c.File("api/openapi.yaml") })
@@ -61,3 +103,34 @@ func InitRoutes(router *echo.Echo, log *slog.Logger, storage *storage.Storage, c
 		return c.HTML(http.StatusOK, page)
 	})
 }
+
+// requestLogger пишет access-лог запросов через slog вместе с клиентом запроса
+func requestLogger(log *slog.Logger) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:    true,
+		LogURI:       true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogRequestID: true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if p, ok := auth.FromContext(c.Request().Context()); ok {
+				attrs = append(attrs, slog.String("principal", p.Actor()), slog.String("role", string(p.Role)))
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			log.LogAttrs(c.Request().Context(), slog.LevelInfo, "request", attrs...)
+			return nil
+		},
+	})
+}
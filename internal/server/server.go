@@ -2,11 +2,17 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 
+	"WB2/internal/auth"
 	"WB2/internal/cache"
 	"WB2/internal/config"
+	"WB2/internal/health"
+	"WB2/internal/ratelimit"
+	"WB2/internal/service"
 	storage "WB2/internal/storage/postgres"
 
 	"github.com/labstack/echo/v4"
@@ -14,23 +20,34 @@ import (
 
 // Server инкапсулирует echo-сервер и конфигурацию
 type Server struct {
-	cfg    *config.Config
-	router *echo.Echo
-	server *http.Server
-	cache  *cache.OrderCache
+	cfg           *config.Config
+	router        *echo.Echo
+	server        *http.Server
+	cache         *cache.OrderCache
+	orders        *service.OrderService
+	authenticator auth.Authenticator
+	limiter       ratelimit.Limiter
+	checker       *health.Checker
 }
 
-func NewServer(cfg *config.Config, c *cache.OrderCache) *Server {
+// NewServer создаёт сервер; authenticator == nil отключает аутентификацию, limiter == nil - rate limiting.
+// checker - проверки готовности для /readyz
+func NewServer(cfg *config.Config, c *cache.OrderCache, orders *service.OrderService, authenticator auth.Authenticator, limiter ratelimit.Limiter, checker *health.Checker) *Server {
 	return &Server{
-		cfg:    cfg,
-		router: echo.New(),
-		cache:  c,
+		cfg:           cfg,
+		router:        echo.New(),
+		cache:         c,
+		orders:        orders,
+		authenticator: authenticator,
+		limiter:       limiter,
+		checker:       checker,
 	}
 }
 
-// Start запускает HTTP-сервер и регистрирует маршруты
-func (s *Server) Start(log *slog.Logger, storage *storage.Storage) error {
-	InitRoutes(s.router, log, storage, s.cfg, s.cache)
+// Start регистрирует маршруты, занимает порт и обслуживает запросы в фоне.
+// Ошибка занятия порта возвращается сразу; если обслуживание прервётся позже, вызывается onServeError
+func (s *Server) Start(log *slog.Logger, storage *storage.Storage, onServeError func(error)) error {
+	InitRoutes(s.router, log, storage, s.cfg, s.cache, s.orders, s.authenticator, s.limiter, s.checker)
 	s.server = &http.Server{
 		Addr:         ":" + s.cfg.HTTPServer.Port,
 		Handler:      s.router,
@@ -38,10 +55,22 @@ func (s *Server) Start(log *slog.Logger, storage *storage.Storage) error {
 		WriteTimeout: s.cfg.HTTPServer.Timeout,
 		IdleTimeout:  s.cfg.HTTPServer.IdleTimeout,
 	}
-	return s.server.ListenAndServe()
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			onServeError(err)
+		}
+	}()
+	return nil
 }
 
-// Stop останавливает сервер с graceful shutdown
+// Stop перестаёт принимать соединения и дожидается завершения запросов в обработке
 func (s *Server) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
 	return s.server.Shutdown(ctx)
 }
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+
+	"WB2/internal/apperr"
+	"WB2/internal/dto/request"
+	"WB2/internal/models"
+)
+
+// importChunkSize - число заказов, сохраняемых в одной транзакции при пакетном импорте
+const importChunkSize = 500
+
+// ImportResult - итог импорта одной записи пакета. Err - ошибка apperr: ErrValidation - запись невалидна,
+// ErrConflict - заказ с таким order_uid уже есть, остальное - запись не удалось сохранить
+type ImportResult struct {
+	OrderUID string
+	Err      error
+}
+
+// importCandidate - прошедшая валидацию запись пакета
+type importCandidate struct {
+	index int
+	req   *request.CreateOrderRequest
+	order *models.Order
+}
+
+// ImportOrders валидирует и сохраняет заказы порциями, возвращая результат по каждому запросу в том же порядке.
+// В отличие от CreateOrders ошибка одной записи не отменяет остальные. Дубликатом, как и в CreateOrder,
+// считается заказ с уже известным order_uid - в хранилище или у сохранённой записи того же пакета.
+// Ошибка вызова - только если не удалось проверить, какие заказы уже есть
+func (s *OrderService) ImportOrders(ctx context.Context, reqs []*request.CreateOrderRequest) ([]ImportResult, error) {
+	results := make([]ImportResult, len(reqs))
+	candidates := make([]importCandidate, 0, len(reqs))
+	uids := make([]string, 0, len(reqs))
+	for i, req := range reqs {
+		if err := req.Validate(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		candidates = append(candidates, importCandidate{index: i, req: req, order: req.ToOrderModel()})
+		if req.OrderUID != "" {
+			uids = append(uids, req.OrderUID)
+		}
+	}
+
+	saved, err := s.repo.ExistingOrderUIDs(ctx, uids)
+	if err != nil {
+		return nil, apperr.FromStorage(err, nil, nil)
+	}
+
+	// Запись, которая совпадает с ещё не сохранённой записью текущей порции, откладывается до следующей:
+	// станет ли она дубликатом, зависит от того, сохранится ли первая
+	for queue := candidates; len(queue) > 0; {
+		var chunk, rest []importCandidate
+		chunkUIDs := make(map[string]bool)
+		for _, cand := range queue {
+			uid := cand.order.OrderUID
+			switch {
+			case saved[uid]:
+				results[cand.index] = ImportResult{OrderUID: uid, Err: errOrderExists(uid)}
+			case len(chunk) == importChunkSize || chunkUIDs[uid]:
+				rest = append(rest, cand)
+			default:
+				chunkUIDs[uid] = true
+				chunk = append(chunk, cand)
+			}
+		}
+		s.importChunk(ctx, chunk, results, saved)
+		queue = rest
+	}
+	return results, nil
+}
+
+// importChunk сохраняет порцию одной транзакцией. Если транзакция не прошла, записи сохраняются
+// по одной, чтобы ошибкой была отмечена только плохая запись, а не вся порция.
+// saved - order_uid, которые уже есть в хранилище; пополняется сохранёнными записями
+func (s *OrderService) importChunk(ctx context.Context, chunk []importCandidate, results []ImportResult, saved map[string]bool) {
+	orders := make([]*models.Order, len(chunk))
+	for i := range chunk {
+		orders[i] = chunk[i].order
+	}
+	err := s.repo.CreateOrdersBatch(ctx, orders)
+	if err == nil {
+		for _, cand := range chunk {
+			s.imported(cand.order, cand.index, results, saved)
+		}
+		return
+	}
+	if apperr.IsUnavailable(err) {
+		// хранилище недоступно: сохранять по одной бессмысленно
+		for _, cand := range chunk {
+			results[cand.index] = ImportResult{OrderUID: cand.order.OrderUID, Err: apperr.FromStorage(err, nil, nil)}
+		}
+		return
+	}
+	for _, cand := range chunk {
+		// Откаченная транзакция оставила в модели присвоенные ID, поэтому заказ строится заново
+		order := cand.req.ToOrderModel()
+		order.OrderUID, order.DateCreated = cand.order.OrderUID, cand.order.DateCreated
+		if _, err := s.repo.CreateOrder(ctx, order); err != nil {
+			results[cand.index] = ImportResult{OrderUID: order.OrderUID, Err: apperr.FromStorage(err, nil, errOrderExists(order.OrderUID))}
+			continue
+		}
+		s.imported(order, cand.index, results, saved)
+	}
+}
+
+func (s *OrderService) imported(order *models.Order, index int, results []ImportResult, saved map[string]bool) {
+	saved[order.OrderUID] = true
+	s.cache.Set(order)
+	results[index] = ImportResult{OrderUID: order.OrderUID}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"WB2/internal/apperr"
+	"WB2/internal/models"
+)
+
+func errCustomerNotFound() *apperr.Error {
+	return apperr.NotFound("customer_not_found", "no orders for customer")
+}
+
+// GetCustomerOrders возвращает все заказы клиента, включая удалённые; если заказов нет - ErrNotFound
+func (s *OrderService) GetCustomerOrders(ctx context.Context, customerID string) ([]models.Order, error) {
+	orders, err := s.repo.GetCustomerOrders(ctx, customerID)
+	if err != nil {
+		return nil, apperr.FromStorage(err, nil, nil)
+	}
+	if len(orders) == 0 {
+		return nil, errCustomerNotFound()
+	}
+	return orders, nil
+}
+
+// EraseCustomer обезличивает данные получателя во всех заказах клиента, убирает эти заказы из кэша
+// и возвращает их UID. Кэш заполнится обезличенными данными при следующем чтении из хранилища
+func (s *OrderService) EraseCustomer(ctx context.Context, customerID string) ([]string, error) {
+	uids, err := s.repo.EraseCustomer(ctx, customerID)
+	if err != nil {
+		return nil, apperr.FromStorage(err, errCustomerNotFound(), nil)
+	}
+	for _, uid := range uids {
+		s.cache.Delete(uid)
+	}
+	return uids, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"WB2/internal/apperr"
+	"WB2/internal/dto/request"
+	"WB2/internal/models"
+)
+
+// ApplyEvent применяет событие заказа из Kafka и возвращает результат: models.EventApplied, EventNoop,
+// EventStale или EventDuplicate. События, кроме order.created, записываются в журнал order_events:
+// повтор уже обработанного события ничего не меняет, а order.updated и item.status_changed старше
+// уже применённых отбрасываются. Порядок событий одного заказа обеспечивает consumer
+// (ключ сообщения - order_uid); событие для ещё не созданного заказа возвращает ErrNotFound
+func (s *OrderService) ApplyEvent(ctx context.Context, ev *request.OrderEvent) (string, error) {
+	if err := ev.Validate(); err != nil {
+		return "", err
+	}
+	if ev.Type == request.EventOrderCreated {
+		if _, err := s.CreateOrder(ctx, ev.Created); err != nil {
+			if errors.Is(err, apperr.ErrConflict) {
+				return models.EventDuplicate, nil
+			}
+			return "", err
+		}
+		return models.EventApplied, nil
+	}
+
+	_, err := s.repo.GetOrderEvent(ctx, ev.ID)
+	switch err := apperr.FromStorage(err, apperr.NotFound("event_not_found", "event not found"), nil); {
+	case err == nil:
+		return models.EventDuplicate, nil
+	case !errors.Is(err, apperr.ErrNotFound):
+		return "", err
+	}
+
+	outcome := models.EventApplied
+	if ev.Type == request.EventOrderUpdated || ev.Type == request.EventItemStatusChanged {
+		last, err := s.repo.LastOrderEventAt(ctx, ev.OrderUID, ev.Type, ev.Subject())
+		if err != nil {
+			return "", apperr.FromStorage(err, nil, nil)
+		}
+		if ev.OccurredAt.Before(last) {
+			outcome = models.EventStale
+		}
+	}
+	if outcome == models.EventApplied {
+		if outcome, err = s.applyEvent(ctx, ev); err != nil {
+			return "", err
+		}
+	}
+
+	rec := &models.OrderEvent{
+		EventID:    ev.ID,
+		OrderUID:   ev.OrderUID,
+		Type:       ev.Type,
+		Subject:    ev.Subject(),
+		OccurredAt: ev.OccurredAt,
+		Outcome:    outcome,
+	}
+	if err := s.repo.SaveOrderEvent(ctx, rec); err != nil {
+		return "", apperr.FromStorage(err, nil, nil)
+	}
+	return outcome, nil
+}
+
+// applyEvent вносит изменение события в заказ. Каждое событие идемпотентно и само по себе, поэтому
+// повтор после сбоя между изменением и записью в журнал безопасен
+func (s *OrderService) applyEvent(ctx context.Context, ev *request.OrderEvent) (string, error) {
+	switch ev.Type {
+	case request.EventOrderUpdated:
+		if _, err := s.UpdateOrder(ctx, ev.Updated); err != nil {
+			return "", err
+		}
+		return models.EventApplied, nil
+
+	case request.EventOrderCancelled:
+		reason := ev.Cancelled.Reason
+		if reason == "" {
+			reason = ev.Type + " event"
+		}
+		return s.transition(ctx, ev.OrderUID, models.OrderStatusCancelled, reason, models.OrderStatusCancelled)
+
+	case request.EventPaymentCaptured:
+		order, err := s.repo.GetOrder(ctx, ev.OrderUID)
+		if err != nil {
+			return "", apperr.FromStorage(err, errOrderNotFound(), nil)
+		}
+		p := ev.PaymentCaptured
+		if p.Transaction != "" && p.Transaction != order.Payment.Transaction {
+			return "", apperr.Validation("payment does not match the order",
+				apperr.FieldError{Field: "payload.transaction", Message: "differs from the order payment transaction"})
+		}
+		if p.Amount != 0 && p.Amount != order.Payment.Amount {
+			return "", apperr.Validation("payment does not match the order",
+				apperr.FieldError{Field: "payload.amount", Message: "differs from the order payment amount"})
+		}
+		// заказ, который уже оплачен и ушёл дальше по жизненному циклу, повторно не переводится
+		return s.transition(ctx, ev.OrderUID, models.OrderStatusPaid, "payment captured", models.OrderStatusPaid,
+			models.OrderStatusAssembling, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusReturned)
+
+	case request.EventItemStatusChanged:
+		order, err := s.repo.GetOrder(ctx, ev.OrderUID)
+		if err != nil {
+			return "", apperr.FromStorage(err, errOrderNotFound(), nil)
+		}
+		rid, status := ev.ItemStatus.Rid, models.ItemStatus(ev.ItemStatus.Status)
+		i := slices.IndexFunc(order.Items, func(it models.Item) bool { return it.Rid == rid })
+		if i < 0 {
+			return "", apperr.NotFound("item_not_found", "order has no item with rid "+rid)
+		}
+		if order.Items[i].Status == status {
+			return models.EventNoop, nil
+		}
+		updated, err := s.repo.UpdateOrder(ctx, ev.OrderUID, func(o *models.Order) {
+			for j := range o.Items {
+				if o.Items[j].Rid == rid {
+					o.Items[j].Status = status
+				}
+			}
+		})
+		if err != nil {
+			return "", apperr.FromStorage(err, errOrderNotFound(), nil)
+		}
+		s.cache.Set(updated)
+		return models.EventApplied, nil
+	}
+	return "", apperr.Validation("invalid order event", apperr.FieldError{Field: "type", Message: "unsupported event type " + ev.Type})
+}
+
+// transition переводит заказ в статус to. Если переход недопустим, но заказ уже в одном из статусов done,
+// событие считается применённым ранее (EventNoop); иначе возвращается ErrConflict
+func (s *OrderService) transition(ctx context.Context, orderUID string, to models.OrderStatus, reason string, done ...models.OrderStatus) (string, error) {
+	_, err := s.TransitionOrderStatus(ctx, orderUID, to, reason)
+	if err == nil {
+		return models.EventApplied, nil
+	}
+	if !errors.Is(err, apperr.ErrConflict) {
+		return "", err
+	}
+	current, getErr := s.repo.GetOrder(ctx, orderUID)
+	if getErr != nil {
+		return "", apperr.FromStorage(getErr, errOrderNotFound(), nil)
+	}
+	if slices.Contains(done, current.Status) {
+		return models.EventNoop, nil
+	}
+	return "", err
+}
@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/cache"
+	"WB2/internal/dto/request"
+	"WB2/internal/models"
+	"WB2/internal/service"
+	"WB2/internal/service/servicetest"
+	storage "WB2/internal/storage/postgres"
+)
+
+// newSQLiteService - сервис поверх настоящего хранилища: идемпотентность событий держится
+// на уникальных ключах и журнале событий в БД, которых нет у хранилища в памяти
+func newSQLiteService(t *testing.T) (*service.OrderService, *storage.Storage) {
+	t.Helper()
+	db, err := storage.NewSQLiteStorage(":memory:", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return service.NewOrderService(db, cache.NewOrderCache(time.Minute)), db
+}
+
+var eventTime = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func applyEvent(t *testing.T, s *service.OrderService, ev *request.OrderEvent, want string) {
+	t.Helper()
+	outcome, err := s.ApplyEvent(t.Context(), ev)
+	if err != nil {
+		t.Fatalf("%s %s: %v", ev.Type, ev.ID, err)
+	}
+	if outcome != want {
+		t.Fatalf("%s %s: outcome %q, want %q", ev.Type, ev.ID, outcome, want)
+	}
+}
+
+func createdEvent(uid string) *request.OrderEvent {
+	return &request.OrderEvent{ID: "created-" + uid, Type: request.EventOrderCreated, OrderUID: uid, OccurredAt: eventTime,
+		Created: servicetest.NewCreateOrderRequest(uid)}
+}
+
+func updatedEvent(id, uid, city string, at time.Time) *request.OrderEvent {
+	return &request.OrderEvent{ID: id, Type: request.EventOrderUpdated, OrderUID: uid, OccurredAt: at,
+		Updated: &request.UpdateOrderRequest{OrderUID: uid, Delivery: &request.UpdateDeliveryRequest{City: city}}}
+}
+
+func itemStatusEvent(id, uid, rid string, status int, at time.Time) *request.OrderEvent {
+	return &request.OrderEvent{ID: id, Type: request.EventItemStatusChanged, OrderUID: uid, OccurredAt: at,
+		ItemStatus: &request.ItemStatusRequest{Rid: rid, Status: status}}
+}
+
+func auditLen(t *testing.T, db *storage.Storage, uid string) int {
+	t.Helper()
+	records, err := db.GetOrderAudit(t.Context(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(records)
+}
+
+// Повторная доставка события с тем же id ничего не меняет: ни заказ, ни журнал изменений, ни историю статусов
+func TestApplyEventRedeliveryIsNoop(t *testing.T) {
+	s, db := newSQLiteService(t)
+	applyEvent(t, s, createdEvent("order-1"), models.EventApplied)
+
+	update := updatedEvent("update-1", "order-1", "Haifa", eventTime.Add(time.Minute))
+	cancel := &request.OrderEvent{ID: "cancel-1", Type: request.EventOrderCancelled, OrderUID: "order-1",
+		OccurredAt: eventTime.Add(2 * time.Minute), Cancelled: &request.CancelOrderRequest{Reason: "customer"}}
+	applyEvent(t, s, update, models.EventApplied)
+	applyEvent(t, s, cancel, models.EventApplied)
+	audits := auditLen(t, db, "order-1")
+	history, err := db.GetOrderStatusHistory(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// заказ правят после события, а повтор старого события не должен откатить правку
+	if _, err := db.UpdateOrder(t.Context(), "order-1", func(o *models.Order) { o.Delivery.City = "Eilat" }); err != nil {
+		t.Fatal(err)
+	}
+	audits++
+	for _, ev := range []*request.OrderEvent{createdEvent("order-1"), update, cancel, update} {
+		applyEvent(t, s, ev, models.EventDuplicate)
+	}
+
+	order, err := db.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Delivery.City != "Eilat" || order.Status != models.OrderStatusCancelled {
+		t.Fatalf("order after redelivery: city %q, status %s", order.Delivery.City, order.Status)
+	}
+	if got := auditLen(t, db, "order-1"); got != audits {
+		t.Errorf("audit has %d records after redelivery, want %d", got, audits)
+	}
+	after, err := db.GetOrderStatusHistory(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(history) {
+		t.Errorf("status history has %d records after redelivery, want %d", len(after), len(history))
+	}
+	if _, err := db.GetOrderEvent(t.Context(), "update-1"); err != nil {
+		t.Errorf("applied event is not journaled: %v", err)
+	}
+}
+
+// Событие старше уже применённого события того же вида пропускается и записывается в журнал как stale,
+// а события другого вида или другого товара от него не зависят
+func TestApplyEventIgnoresStaleEvents(t *testing.T) {
+	s, db := newSQLiteService(t)
+	applyEvent(t, s, createdEvent("order-1"), models.EventApplied)
+	order, err := db.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rid := order.Items[0].Rid
+
+	applyEvent(t, s, updatedEvent("update-new", "order-1", "Haifa", eventTime.Add(2*time.Minute)), models.EventApplied)
+	audits := auditLen(t, db, "order-1")
+	applyEvent(t, s, updatedEvent("update-old", "order-1", "Eilat", eventTime.Add(time.Minute)), models.EventStale)
+
+	applyEvent(t, s, itemStatusEvent("item-new", "order-1", rid, 300, eventTime.Add(2*time.Minute)), models.EventApplied)
+	applyEvent(t, s, itemStatusEvent("item-old", "order-1", rid, 250, eventTime.Add(time.Minute)), models.EventStale)
+	audits++
+
+	order, err = db.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Delivery.City != "Haifa" {
+		t.Errorf("city %q, want the newer update Haifa", order.Delivery.City)
+	}
+	if order.Items[0].Status != 300 {
+		t.Errorf("item status %d, want the newer 300", order.Items[0].Status)
+	}
+	if got := auditLen(t, db, "order-1"); got != audits {
+		t.Errorf("audit has %d records, want %d: a stale event changed the order", got, audits)
+	}
+	rec, err := db.GetOrderEvent(t.Context(), "update-old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Outcome != models.EventStale {
+		t.Errorf("stale event journaled as %q", rec.Outcome)
+	}
+	// повтор устаревшего события - уже дубликат
+	applyEvent(t, s, updatedEvent("update-old", "order-1", "Eilat", eventTime.Add(time.Minute)), models.EventDuplicate)
+
+	// событие того же времени, что и последнее применённое, не считается устаревшим
+	applyEvent(t, s, updatedEvent("update-same", "order-1", "Akko", eventTime.Add(2*time.Minute)), models.EventApplied)
+}
+
+// order.created для уже существующего order_uid - дубликат, а не ошибка: сообщение просто повторили
+// без id события или тот же заказ пришёл из другого топика. Существующий заказ не перезаписывается
+func TestApplyEventCreatedForExistingOrderIsDuplicate(t *testing.T) {
+	s, db := newSQLiteService(t)
+	applyEvent(t, s, createdEvent("order-1"), models.EventApplied)
+	audits := auditLen(t, db, "order-1")
+
+	again := createdEvent("order-1")
+	again.ID = "another-id"
+	again.Created.Delivery.City = "Haifa"
+	applyEvent(t, s, again, models.EventDuplicate)
+
+	order, err := db.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Delivery.City != "Kiryat Mozkin" {
+		t.Errorf("duplicate order.created overwrote the order: city %q", order.Delivery.City)
+	}
+	if got := auditLen(t, db, "order-1"); got != audits {
+		t.Errorf("audit has %d records, want %d", got, audits)
+	}
+
+	// а событие для заказа, которого нет, - ошибка: его некуда применить
+	_, err = s.ApplyEvent(t.Context(), updatedEvent("update-1", "order-2", "Haifa", eventTime))
+	if !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("event for unknown order: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/audit"
+	"WB2/internal/dto/response"
+	"WB2/internal/models"
+)
+
+// GetOrderTransitions возвращает заказ (из кэша, как GetOrder) и историю смены его статусов
+func (s *OrderService) GetOrderTransitions(ctx context.Context, orderUID string) (*models.Order, []models.OrderStatusHistory, error) {
+	order, err := s.GetOrder(ctx, orderUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := s.repo.GetOrderStatusHistory(ctx, orderUID)
+	if err != nil {
+		return nil, nil, apperr.FromStorage(err, nil, nil)
+	}
+	return order, history, nil
+}
+
+// GetOrderHistory возвращает журнал изменений заказа, в том числе удалённого; пустой журнал - ErrNotFound
+func (s *OrderService) GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderAudit, error) {
+	records, err := s.repo.GetOrderAudit(ctx, orderUID)
+	if err != nil {
+		return nil, apperr.FromStorage(err, nil, nil)
+	}
+	if len(records) == 0 {
+		return nil, apperr.NotFound("order_not_found", "no history for order")
+	}
+	return records, nil
+}
+
+// GetOrderAt восстанавливает заказ на момент at по журналу изменений; nil - заказа в этот момент не было
+func (s *OrderService) GetOrderAt(ctx context.Context, orderUID string, at time.Time) (*response.OrderResponse, error) {
+	records, err := s.repo.GetOrderAuditUntil(ctx, orderUID, at)
+	if err != nil {
+		return nil, apperr.FromStorage(err, nil, nil)
+	}
+	return audit.Reconstruct(records)
+}
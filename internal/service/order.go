@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/cache"
+	"WB2/internal/dto/request"
+	"WB2/internal/models"
+)
+
+// Repository - хранилище заказов, с которым работает OrderService.
+// Ошибки - как у GORM: gorm.ErrRecordNotFound, gorm.ErrDuplicatedKey и прочие
+type Repository interface {
+	CreateOrder(ctx context.Context, order *models.Order) (string, error)
+	// CreateOrdersBatch сохраняет все заказы в одной транзакции: либо все, либо ни одного
+	CreateOrdersBatch(ctx context.Context, orders []*models.Order) error
+	// ExistingOrderUIDs возвращает множество order_uid из списка, которые уже есть в хранилище
+	ExistingOrderUIDs(ctx context.Context, uids []string) (map[string]bool, error)
+	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
+	// ListOrders с пустым фильтром возвращает все заказы
+	ListOrders(ctx context.Context, f models.OrderFilter) ([]models.Order, error)
+	// StreamOrders передаёт fn заказы под фильтр порциями по batchSize
+	StreamOrders(ctx context.Context, f models.OrderFilter, batchSize int, fn func([]models.Order) error) error
+	UpdateOrder(ctx context.Context, orderUID string, apply func(order *models.Order)) (*models.Order, error)
+	DeleteOrder(ctx context.Context, orderUID string) (string, error)
+	// TransitionOrderStatus возвращает models.ErrIllegalTransition, если переход не разрешён таблицей статусов
+	TransitionOrderStatus(ctx context.Context, orderUID string, to models.OrderStatus, reason string) (*models.Order, error)
+	GetOrderStatusHistory(ctx context.Context, orderUID string) ([]models.OrderStatusHistory, error)
+
+	// Журнал изменений заказа, в том числе удалённого; GetOrderAuditUntil - записи не позже until
+	GetOrderAudit(ctx context.Context, orderUID string) ([]models.OrderAudit, error)
+	GetOrderAuditUntil(ctx context.Context, orderUID string, until time.Time) ([]models.OrderAudit, error)
+
+	// Заказы клиента, включая удалённые. EraseCustomer обезличивает их и возвращает UID;
+	// если заказов нет - gorm.ErrRecordNotFound
+	GetCustomerOrders(ctx context.Context, customerID string) ([]models.Order, error)
+	EraseCustomer(ctx context.Context, customerID string) ([]string, error)
+
+	// Журнал обработанных событий заказа из Kafka (см. ApplyEvent)
+	GetOrderEvent(ctx context.Context, eventID string) (*models.OrderEvent, error)
+	LastOrderEventAt(ctx context.Context, orderUID, eventType, subject string) (time.Time, error)
+	SaveOrderEvent(ctx context.Context, e *models.OrderEvent) error
+}
+
+// OrderService - операции над заказами, общие для HTTP API и Kafka consumer:
+// валидация запроса, сохранение через Repository (с журналом изменений), кэш и перевод ошибок в apperr
+type OrderService struct {
+	repo  Repository
+	cache *cache.OrderCache
+}
+
+func NewOrderService(repo Repository, c *cache.OrderCache) *OrderService {
+	return &OrderService{repo: repo, cache: c}
+}
+
+func errOrderNotFound() *apperr.Error {
+	return apperr.NotFound("order_not_found", "order not found")
+}
+
+func errOrderExists(orderUID string) *apperr.Error {
+	return apperr.Conflict("order_exists", "order "+orderUID+" already exists")
+}
+
+// CreateOrder валидирует запрос и сохраняет заказ; автор изменения берётся из ctx (audit.WithActor)
+func (s *OrderService) CreateOrder(ctx context.Context, req *request.CreateOrderRequest) (*models.Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	order := req.ToOrderModel()
+	if _, err := s.repo.CreateOrder(ctx, order); err != nil {
+		return nil, apperr.FromStorage(err, nil, errOrderExists(order.OrderUID))
+	}
+	s.cache.Set(order)
+	return order, nil
+}
+
+// CreateOrders валидирует запросы и сохраняет заказы одной транзакцией. Ошибка любой записи
+// (невалидный запрос, уже существующий заказ) отменяет всю пачку; какая запись виновата,
+// можно выяснить, сохраняя их по одной через CreateOrder
+func (s *OrderService) CreateOrders(ctx context.Context, reqs []*request.CreateOrderRequest) ([]*models.Order, error) {
+	orders := make([]*models.Order, len(reqs))
+	for i, req := range reqs {
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		orders[i] = req.ToOrderModel()
+	}
+	if err := s.repo.CreateOrdersBatch(ctx, orders); err != nil {
+		return nil, apperr.FromStorage(err, nil, apperr.Conflict("order_exists", "one of the orders already exists"))
+	}
+	for _, order := range orders {
+		s.cache.Set(order)
+	}
+	return orders, nil
+}
+
+// GetOrder возвращает заказ из кэша, при промахе - из хранилища с наполнением кэша
+func (s *OrderService) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	if order, ok := s.cache.Get(orderUID); ok {
+		return order, nil
+	}
+	order, err := s.repo.GetOrder(ctx, orderUID)
+	if err != nil {
+		return nil, apperr.FromStorage(err, errOrderNotFound(), nil)
+	}
+	s.cache.Set(order)
+	return order, nil
+}
+
+// ListOrders возвращает заказы под фильтр. Без фильтра отдаётся содержимое кэша
+// (пустой кэш наполняется из хранилища); с фильтром выборка всегда идёт из хранилища,
+// потому что в кэше могут быть не все заказы
+func (s *OrderService) ListOrders(ctx context.Context, f models.OrderFilter) ([]models.Order, error) {
+	if !f.IsEmpty() {
+		orders, err := s.repo.ListOrders(ctx, f)
+		if err != nil {
+			return nil, apperr.FromStorage(err, nil, nil)
+		}
+		return orders, nil
+	}
+
+	cached := s.cache.GetAll()
+	if len(cached) == 0 {
+		orders, err := s.repo.ListOrders(ctx, f)
+		if err != nil {
+			return nil, apperr.FromStorage(err, nil, nil)
+		}
+		for i := range orders {
+			o := orders[i]
+			s.cache.Set(&o)
+		}
+		cached = s.cache.GetAll()
+	}
+	orders := make([]models.Order, len(cached))
+	for i := range cached {
+		orders[i] = *cached[i]
+	}
+	return orders, nil
+}
+
+// StreamOrders передаёт fn заказы под фильтр порциями по batchSize прямо из хранилища, минуя кэш,
+// чтобы выгрузка любого объёма не держала все заказы в памяти. Ошибка fn прерывает чтение и возвращается как есть
+func (s *OrderService) StreamOrders(ctx context.Context, f models.OrderFilter, batchSize int, fn func([]models.Order) error) error {
+	return apperr.FromStorage(s.repo.StreamOrders(ctx, f, batchSize, fn), nil, nil)
+}
+
+// UpdateOrder валидирует запрос и применяет его к заказу в одной транзакции хранилища
+func (s *OrderService) UpdateOrder(ctx context.Context, req *request.UpdateOrderRequest) (*models.Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	order, err := s.repo.UpdateOrder(ctx, req.OrderUID, req.UpdateOrderModel)
+	if err != nil {
+		return nil, apperr.FromStorage(err, errOrderNotFound(), nil)
+	}
+	s.cache.Set(order)
+	return order, nil
+}
+
+// DeleteOrder удаляет заказ и убирает его из кэша
+func (s *OrderService) DeleteOrder(ctx context.Context, orderUID string) error {
+	if _, err := s.repo.DeleteOrder(ctx, orderUID); err != nil {
+		return apperr.FromStorage(err, errOrderNotFound(), nil)
+	}
+	s.cache.Delete(orderUID)
+	return nil
+}
+
+// TransitionOrderStatus переводит заказ в статус to по таблице переходов; недопустимый переход - ErrConflict
+func (s *OrderService) TransitionOrderStatus(ctx context.Context, orderUID string, to models.OrderStatus, reason string) (*models.Order, error) {
+	order, err := s.repo.TransitionOrderStatus(ctx, orderUID, to, reason)
+	if err != nil {
+		if errors.Is(err, models.ErrIllegalTransition) {
+			return nil, apperr.Conflict("illegal_transition", err.Error())
+		}
+		return nil, apperr.FromStorage(err, errOrderNotFound(), nil)
+	}
+	s.cache.Set(order)
+	return order, nil
+}
@@ -0,0 +1,267 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"WB2/internal/apperr"
+	"WB2/internal/cache"
+	"WB2/internal/dto/request"
+	"WB2/internal/models"
+	"WB2/internal/service"
+	"WB2/internal/service/servicetest"
+)
+
+func newService(t *testing.T) (*service.OrderService, *servicetest.MemoryRepository, *cache.OrderCache) {
+	t.Helper()
+	repo := servicetest.NewMemoryRepository()
+	c := cache.NewOrderCache(time.Minute)
+	return service.NewOrderService(repo, c), repo, c
+}
+
+func mustCreate(t *testing.T, s *service.OrderService, uid string) *models.Order {
+	t.Helper()
+	order, err := s.CreateOrder(t.Context(), servicetest.NewCreateOrderRequest(uid))
+	if err != nil {
+		t.Fatalf("create %s: %v", uid, err)
+	}
+	return order
+}
+
+func TestCreateOrder(t *testing.T) {
+	s, repo, c := newService(t)
+	order := mustCreate(t, s, "order-1")
+	if order.ID == 0 || order.Status != models.OrderStatusNew {
+		t.Fatalf("created %+v, want a saved order in status new", order)
+	}
+	if _, ok := c.Get("order-1"); !ok {
+		t.Fatal("created order is not cached")
+	}
+
+	_, err := s.CreateOrder(t.Context(), servicetest.NewCreateOrderRequest("order-1"))
+	if !errors.Is(err, apperr.ErrConflict) {
+		t.Fatalf("duplicate: got %v, want ErrConflict", err)
+	}
+
+	invalid := servicetest.NewCreateOrderRequest("order-2")
+	invalid.Items = nil
+	calls := repo.Calls("CreateOrder")
+	if _, err := s.CreateOrder(t.Context(), invalid); !errors.Is(err, apperr.ErrValidation) {
+		t.Fatalf("invalid: got %v, want ErrValidation", err)
+	}
+	if repo.Calls("CreateOrder") != calls {
+		t.Fatal("invalid order reached the repository")
+	}
+}
+
+func TestCreateOrdersIsAllOrNothing(t *testing.T) {
+	s, repo, c := newService(t)
+	mustCreate(t, s, "existing")
+	_, err := s.CreateOrders(t.Context(), []*request.CreateOrderRequest{servicetest.NewCreateOrderRequest("new-1"), servicetest.NewCreateOrderRequest("existing")})
+	if !errors.Is(err, apperr.ErrConflict) {
+		t.Fatalf("got %v, want ErrConflict", err)
+	}
+	if repo.Len() != 1 || c.Len() != 1 {
+		t.Fatalf("failed batch left %d orders in the repository and %d in the cache", repo.Len(), c.Len())
+	}
+
+	orders, err := s.CreateOrders(t.Context(), []*request.CreateOrderRequest{servicetest.NewCreateOrderRequest("new-1"), servicetest.NewCreateOrderRequest("new-2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || repo.Len() != 3 || c.Len() != 3 {
+		t.Fatalf("saved %d orders, repository has %d, cache has %d", len(orders), repo.Len(), c.Len())
+	}
+}
+
+func TestGetOrderUsesCache(t *testing.T) {
+	s, repo, c := newService(t)
+	mustCreate(t, s, "order-1")
+
+	if _, err := s.GetOrder(t.Context(), "order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := repo.Calls("GetOrder"); n != 0 {
+		t.Fatalf("cached order read from the repository %d times", n)
+	}
+
+	c.Delete("order-1")
+	if _, err := s.GetOrder(t.Context(), "order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("order-1"); !ok || repo.Calls("GetOrder") != 1 {
+		t.Fatal("cache miss did not load the order from the repository into the cache")
+	}
+
+	if _, err := s.GetOrder(t.Context(), "missing"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("missing: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateOrderRefreshesCache(t *testing.T) {
+	s, _, _ := newService(t)
+	mustCreate(t, s, "order-1")
+
+	updated, err := s.UpdateOrder(t.Context(), &request.UpdateOrderRequest{
+		OrderUID: "order-1", TrackNumber: "NEWTRACK", Delivery: &request.UpdateDeliveryRequest{City: "Kazan"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.TrackNumber != "NEWTRACK" || updated.Delivery.City != "Kazan" || updated.Delivery.Name != "Test Testov" {
+		t.Fatalf("updated %+v, want new track and city with the other fields kept", updated)
+	}
+	got, err := s.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TrackNumber != "NEWTRACK" {
+		t.Fatalf("cache serves stale track %q", got.TrackNumber)
+	}
+
+	_, err = s.UpdateOrder(t.Context(), &request.UpdateOrderRequest{OrderUID: "missing", TrackNumber: "X"})
+	if !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("missing: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteOrderInvalidatesCache(t *testing.T) {
+	s, repo, c := newService(t)
+	mustCreate(t, s, "order-1")
+
+	if err := s.DeleteOrder(t.Context(), "order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("order-1"); ok {
+		t.Fatal("deleted order is still cached")
+	}
+	if repo.Len() != 0 {
+		t.Fatal("order is not deleted from the repository")
+	}
+	if _, err := s.GetOrder(t.Context(), "order-1"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("get deleted: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteOrder(t.Context(), "order-1"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("delete twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestTransitionOrderStatus(t *testing.T) {
+	s, _, c := newService(t)
+	mustCreate(t, s, "order-1")
+
+	for _, to := range []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusAssembling, models.OrderStatusShipped} {
+		order, err := s.TransitionOrderStatus(t.Context(), "order-1", to, "test")
+		if err != nil {
+			t.Fatalf("-> %s: %v", to, err)
+		}
+		if cached, _ := c.Get("order-1"); order.Status != to || cached.Status != to {
+			t.Fatalf("-> %s: got %s, cached %s", to, order.Status, cached.Status)
+		}
+	}
+
+	_, err := s.TransitionOrderStatus(t.Context(), "order-1", models.OrderStatusCancelled, "too late")
+	if !errors.Is(err, apperr.ErrConflict) {
+		t.Fatalf("shipped -> cancelled: got %v, want ErrConflict", err)
+	}
+	if cached, _ := c.Get("order-1"); cached.Status != models.OrderStatusShipped {
+		t.Fatalf("rejected transition changed the cached status to %s", cached.Status)
+	}
+	if _, err := s.TransitionOrderStatus(t.Context(), "missing", models.OrderStatusPaid, ""); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("missing: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestListOrdersFilter(t *testing.T) {
+	s, repo, _ := newService(t)
+	mustCreate(t, s, "order-1")
+	other := servicetest.NewCreateOrderRequest("order-2")
+	other.CustomerID = "other"
+	if _, err := s.CreateOrder(t.Context(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.ListOrders(t.Context(), models.OrderFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || repo.Calls("ListOrders") != 0 {
+		t.Fatalf("got %d orders with %d repository calls, want 2 from the cache", len(all), repo.Calls("ListOrders"))
+	}
+	filtered, err := s.ListOrders(t.Context(), models.OrderFilter{CustomerID: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 1 || filtered[0].OrderUID != "order-2" {
+		t.Fatalf("filtered %v, want order-2", filtered)
+	}
+}
+
+// Импорт отчитывается по каждой записи: невалидная и уже существующая не мешают остальным,
+// а запись с тем же order_uid, что у сохранённой ранее в пакете, - дубликат
+func TestImportOrdersReportsEachRecord(t *testing.T) {
+	s, repo, c := newService(t)
+	mustCreate(t, s, "existing")
+	invalid := servicetest.NewCreateOrderRequest("invalid")
+	invalid.Items = nil
+	results, err := s.ImportOrders(t.Context(), []*request.CreateOrderRequest{
+		servicetest.NewCreateOrderRequest("new-1"), invalid, servicetest.NewCreateOrderRequest("existing"), servicetest.NewCreateOrderRequest("new-1"), servicetest.NewCreateOrderRequest("new-2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []error{nil, apperr.ErrValidation, apperr.ErrConflict, apperr.ErrConflict, nil}
+	for i, r := range results {
+		if want[i] == nil && r.Err != nil || want[i] != nil && !errors.Is(r.Err, want[i]) {
+			t.Errorf("record %d: got %v, want %v", i, r.Err, want[i])
+		}
+	}
+	if repo.Len() != 3 || c.Len() != 3 {
+		t.Fatalf("repository has %d orders and cache %d, want 3", repo.Len(), c.Len())
+	}
+
+	// недоступность хранилища - ошибка вызова, а не отказ по каждой записи
+	repo.FailWith(apperr.ErrUnavailable)
+	if _, err := s.ImportOrders(t.Context(), []*request.CreateOrderRequest{servicetest.NewCreateOrderRequest("new-3")}); !errors.Is(err, apperr.ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestEraseCustomerInvalidatesCache(t *testing.T) {
+	s, _, c := newService(t)
+	mustCreate(t, s, "order-1")
+	uids, err := s.EraseCustomer(t.Context(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uids) != 1 || uids[0] != "order-1" {
+		t.Fatalf("erased %v, want order-1", uids)
+	}
+	if _, ok := c.Get("order-1"); ok {
+		t.Fatal("erased order is still cached")
+	}
+	order, err := s.GetOrder(t.Context(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Delivery.Name != models.ErasedName || order.Delivery.Phone != "" {
+		t.Fatalf("delivery %+v is not anonymised", order.Delivery)
+	}
+	if _, err := s.EraseCustomer(t.Context(), "nobody"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("unknown customer: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetCustomerOrders(t.Context(), "nobody"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("unknown customer export: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestStorageUnavailable(t *testing.T) {
+	s, repo, _ := newService(t)
+	repo.FailWith(apperr.ErrUnavailable)
+	if _, err := s.CreateOrder(t.Context(), servicetest.NewCreateOrderRequest("order-1")); !errors.Is(err, apperr.ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+	if _, err := s.GetOrder(t.Context(), "order-1"); !errors.Is(err, apperr.ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+}
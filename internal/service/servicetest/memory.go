@@ -0,0 +1,324 @@
+// Package servicetest содержит хранилище заказов в памяти для тестов и бенчмарков кода поверх service.OrderService
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"WB2/internal/encryption"
+	"WB2/internal/models"
+	"WB2/internal/service"
+
+	"gorm.io/gorm"
+)
+
+// MemoryRepository - service.Repository в памяти процесса с теми же ошибками, что у GORM-хранилища:
+// gorm.ErrRecordNotFound, gorm.ErrDuplicatedKey и models.ErrIllegalTransition. Журнал изменений и история статусов
+// не ведутся: их чтение возвращает пустой результат. Удалённые заказы не хранятся. Заказы хранятся копиями, поэтому изменения возвращённого заказа не попадают в хранилище
+type MemoryRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	orders map[string]*models.Order
+	events map[string]models.OrderEvent
+	err    error
+	calls  map[string]int
+}
+
+var _ service.Repository = (*MemoryRepository)(nil)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		orders: make(map[string]*models.Order),
+		events: make(map[string]models.OrderEvent),
+		calls:  make(map[string]int),
+	}
+}
+
+// FailWith заставляет все следующие вызовы возвращать err (например, недоступность БД); nil снимает отказ
+func (r *MemoryRepository) FailWith(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+}
+
+// Calls возвращает, сколько раз вызывался метод репозитория method (в том числе неудачно)
+func (r *MemoryRepository) Calls(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[method]
+}
+
+// Len возвращает число сохранённых (не удалённых) заказов
+func (r *MemoryRepository) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.orders)
+}
+
+// begin захватывает mu, учитывает вызов method и возвращает ошибку, заданную FailWith
+func (r *MemoryRepository) begin(method string) error {
+	r.mu.Lock()
+	r.calls[method]++
+	return r.err
+}
+
+func (r *MemoryRepository) CreateOrder(_ context.Context, order *models.Order) (string, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("CreateOrder"); err != nil {
+		return "", err
+	}
+	if _, ok := r.orders[order.OrderUID]; ok {
+		return "", gorm.ErrDuplicatedKey
+	}
+	r.insert(order)
+	return order.OrderUID, nil
+}
+
+func (r *MemoryRepository) CreateOrdersBatch(_ context.Context, orders []*models.Order) error {
+	defer r.mu.Unlock()
+	if err := r.begin("CreateOrdersBatch"); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		if _, ok := r.orders[order.OrderUID]; ok || seen[order.OrderUID] {
+			return gorm.ErrDuplicatedKey
+		}
+		seen[order.OrderUID] = true
+	}
+	for _, order := range orders {
+		r.insert(order)
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ExistingOrderUIDs(_ context.Context, uids []string) (map[string]bool, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("ExistingOrderUIDs"); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for _, uid := range uids {
+		if _, ok := r.orders[uid]; ok {
+			existing[uid] = true
+		}
+	}
+	return existing, nil
+}
+
+// insert присваивает заказу и связанным сущностям идентификаторы, как при вставке в БД, выполняет
+// хук BeforeCreate и сохраняет копию
+func (r *MemoryRepository) insert(order *models.Order) {
+	_ = order.BeforeCreate(nil)
+	now := time.Now()
+	r.nextID++
+	order.ID, order.CreatedAt, order.UpdatedAt = r.nextID, now, now
+	order.Delivery.ID, order.Delivery.OrderID = r.nextID, r.nextID
+	order.Payment.ID, order.Payment.OrderID = r.nextID, r.nextID
+	order.Delivery.SetBlindIndexes()
+	order.Payment.SetBlindIndexes()
+	for i := range order.Items {
+		r.nextID++
+		order.Items[i].ID, order.Items[i].OrderID = r.nextID, order.ID
+	}
+	r.orders[order.OrderUID] = clone(order)
+}
+
+func (r *MemoryRepository) GetOrder(_ context.Context, orderUID string) (*models.Order, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("GetOrder"); err != nil {
+		return nil, err
+	}
+	order, ok := r.orders[orderUID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return clone(order), nil
+}
+
+func (r *MemoryRepository) ListOrders(_ context.Context, f models.OrderFilter) ([]models.Order, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("ListOrders"); err != nil {
+		return nil, err
+	}
+	return r.find(f), nil
+}
+
+func (r *MemoryRepository) StreamOrders(_ context.Context, f models.OrderFilter, batchSize int, fn func([]models.Order) error) error {
+	err := r.begin("StreamOrders")
+	orders := r.find(f)
+	// fn вызывается без блокировки: он может обращаться к хранилищу
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for batch := range slices.Chunk(orders, batchSize) {
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find возвращает копии заказов под фильтр в порядке вставки; вызывается под mu
+func (r *MemoryRepository) find(f models.OrderFilter) []models.Order {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if matches(order, f) {
+			orders = append(orders, *clone(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// matches повторяет условия фильтра GORM-хранилища
+func matches(o *models.Order, f models.OrderFilter) bool {
+	switch {
+	case f.CustomerID != "" && o.CustomerID != f.CustomerID,
+		f.TrackNumber != "" && o.TrackNumber != f.TrackNumber,
+		f.DeliveryService != "" && o.DeliveryService != f.DeliveryService,
+		f.CreatedFrom != nil && o.DateCreated.Before(*f.CreatedFrom),
+		f.CreatedTo != nil && !o.DateCreated.Before(*f.CreatedTo),
+		f.Phone != "" && o.Delivery.PhoneHash != encryption.BlindIndex(encryption.NormalizePhone(f.Phone)),
+		f.Email != "" && o.Delivery.EmailHash != encryption.BlindIndex(encryption.NormalizeEmail(f.Email)):
+		return false
+	}
+	return true
+}
+
+func (r *MemoryRepository) UpdateOrder(_ context.Context, orderUID string, apply func(order *models.Order)) (*models.Order, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("UpdateOrder"); err != nil {
+		return nil, err
+	}
+	stored, ok := r.orders[orderUID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	order := clone(stored)
+	apply(order)
+	order.UpdatedAt = time.Now()
+	order.Delivery.SetBlindIndexes()
+	order.Payment.SetBlindIndexes()
+	r.orders[orderUID] = clone(order)
+	return order, nil
+}
+
+func (r *MemoryRepository) DeleteOrder(_ context.Context, orderUID string) (string, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("DeleteOrder"); err != nil {
+		return "", err
+	}
+	if _, ok := r.orders[orderUID]; !ok {
+		return "", gorm.ErrRecordNotFound
+	}
+	delete(r.orders, orderUID)
+	return orderUID, nil
+}
+
+func (r *MemoryRepository) TransitionOrderStatus(_ context.Context, orderUID string, to models.OrderStatus, _ string) (*models.Order, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("TransitionOrderStatus"); err != nil {
+		return nil, err
+	}
+	order, ok := r.orders[orderUID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if !order.Status.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: %s -> %s", models.ErrIllegalTransition, order.Status, to)
+	}
+	order.Status = to
+	order.UpdatedAt = time.Now()
+	return clone(order), nil
+}
+
+func (r *MemoryRepository) GetOrderStatusHistory(context.Context, string) ([]models.OrderStatusHistory, error) {
+	defer r.mu.Unlock()
+	return nil, r.begin("GetOrderStatusHistory")
+}
+
+func (r *MemoryRepository) GetOrderAudit(context.Context, string) ([]models.OrderAudit, error) {
+	defer r.mu.Unlock()
+	return nil, r.begin("GetOrderAudit")
+}
+
+func (r *MemoryRepository) GetOrderAuditUntil(context.Context, string, time.Time) ([]models.OrderAudit, error) {
+	defer r.mu.Unlock()
+	return nil, r.begin("GetOrderAuditUntil")
+}
+
+func (r *MemoryRepository) GetCustomerOrders(_ context.Context, customerID string) ([]models.Order, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("GetCustomerOrders"); err != nil {
+		return nil, err
+	}
+	return r.find(models.OrderFilter{CustomerID: customerID}), nil
+}
+
+func (r *MemoryRepository) EraseCustomer(_ context.Context, customerID string) ([]string, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("EraseCustomer"); err != nil {
+		return nil, err
+	}
+	orders := r.find(models.OrderFilter{CustomerID: customerID})
+	if len(orders) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		r.orders[order.OrderUID].Delivery.Anonymize()
+		uids[i] = order.OrderUID
+	}
+	return uids, nil
+}
+
+func (r *MemoryRepository) GetOrderEvent(_ context.Context, eventID string) (*models.OrderEvent, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("GetOrderEvent"); err != nil {
+		return nil, err
+	}
+	e, ok := r.events[eventID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &e, nil
+}
+
+func (r *MemoryRepository) LastOrderEventAt(_ context.Context, orderUID, eventType, subject string) (time.Time, error) {
+	defer r.mu.Unlock()
+	if err := r.begin("LastOrderEventAt"); err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, e := range r.events {
+		if e.OrderUID == orderUID && e.Type == eventType && e.Subject == subject && e.Outcome == models.EventApplied &&
+			e.OccurredAt.After(last) {
+			last = e.OccurredAt
+		}
+	}
+	return last, nil
+}
+
+func (r *MemoryRepository) SaveOrderEvent(_ context.Context, e *models.OrderEvent) error {
+	defer r.mu.Unlock()
+	if err := r.begin("SaveOrderEvent"); err != nil {
+		return err
+	}
+	if _, ok := r.events[e.EventID]; !ok {
+		e.CreatedAt = time.Now()
+		r.events[e.EventID] = *e
+	}
+	return nil
+}
+
+func clone(o *models.Order) *models.Order {
+	c := *o
+	c.Items = slices.Clone(o.Items)
+	return &c
+}
@@ -0,0 +1,18 @@
+package servicetest
+
+import "WB2/internal/dto/request"
+
+// NewCreateOrderRequest возвращает валидный запрос на создание заказа uid клиента "test".
+// Идентификатор платежа и rid товара выводятся из uid, поэтому заказы с разными uid не пересекаются
+func NewCreateOrderRequest(uid string) *request.CreateOrderRequest {
+	return &request.CreateOrderRequest{
+		OrderUID: uid, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL", Locale: "ru", CustomerID: "test",
+		DeliveryService: "meest", ShardKey: "9", SmID: 99, OofShard: "1",
+		Delivery: request.CreateDeliveryRequest{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: request.CreatePaymentRequest{Transaction: "tx-" + uid, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+		Items: []request.CreateItemRequest{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "rid-" + uid,
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+	}
+}
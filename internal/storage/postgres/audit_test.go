@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"testing"
+
+	"WB2/internal/audit"
+	"WB2/internal/models"
+)
+
+func TestBackfillAuditBaseline(t *testing.T) {
+	path := t.TempDir() + "/orders.db"
+	s, err := NewSQLiteStorage(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// заказы, записанные в обход журнала, как до его появления
+	old := models.Order{OrderUID: "old", Status: models.OrderStatusNew, Delivery: models.Delivery{Name: "Ivan"},
+		Payment: models.Payment{Amount: 100}, Items: []models.Item{{Rid: "r1", Status: models.ItemStatusAccepted}}}
+	gone := models.Order{OrderUID: "gone", Status: models.OrderStatusNew}
+	if err := s.Db.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Db.Create(&gone).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Db.Delete(&gone).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// миграции при повторном открытии пишут начальные снимки, и только один раз
+	for range 2 {
+		reopened, err := NewSQLiteStorage(path, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = reopened.Close() })
+		s = reopened
+	}
+
+	records, err := s.GetOrderAuditUntil(t.Context(), "old", old.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d baseline records, want 4 (order, delivery, payment, item)", len(records))
+	}
+	for _, r := range records {
+		if r.Action != models.AuditActionCreate || r.Actor != audit.BaselineActor {
+			t.Errorf("record %s: action %s by %s, want create by %s", r.Entity, r.Action, r.Actor, audit.BaselineActor)
+		}
+	}
+	order, err := audit.Reconstruct(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order == nil || order.Payment.Amount != 100 || len(order.Items) != 1 {
+		t.Fatalf("reconstructed %+v, want the order with payment and item", order)
+	}
+
+	records, err = s.GetOrderAudit(t.Context(), "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order, err := audit.Reconstruct(records); err != nil || order != nil {
+		t.Fatalf("deleted order reconstructed as %+v (err %v), want nil", order, err)
+	}
+}
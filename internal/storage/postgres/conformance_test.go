@@ -0,0 +1,315 @@
+package storage_test
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"WB2/internal/audit"
+	"WB2/internal/models"
+	storage "WB2/internal/storage/postgres"
+	"WB2/internal/storage/postgres/storagetest"
+
+	"gorm.io/gorm"
+)
+
+func newTestOrder(uid, customerID, phone, email string) *models.Order {
+	return &models.Order{
+		OrderUID: uid, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL", CustomerID: customerID, DateCreated: time.Now().UTC(),
+		Delivery: models.Delivery{Name: "Test Testov", Phone: phone, Email: email, City: "Moscow", Address: "Tverskaya 1", Zip: "123456"},
+		Payment:  models.Payment{Transaction: "tx-" + uid, Currency: "RUB", Amount: 1000, Bank: "alpha"},
+		Items:    []models.Item{{Rid: "rid-" + uid, Name: "Mascaras", Price: 900, Status: models.ItemStatusAccepted}},
+	}
+}
+
+func mustCreateOrder(t *testing.T, s *storage.Storage, order *models.Order) {
+	t.Helper()
+	if _, err := s.CreateOrder(t.Context(), order); err != nil {
+		t.Fatalf("create %s: %v", order.OrderUID, err)
+	}
+}
+
+func actions(records []models.OrderAudit) []string {
+	var list []string
+	for _, r := range records {
+		list = append(list, string(r.Action)+" "+string(r.Entity))
+	}
+	return list
+}
+
+// TestStorageConformance проверяет, что SQLite и PostgreSQL ведут себя одинаково там, где на это
+// рассчитывают сервис и обработчики
+func TestStorageConformance(t *testing.T) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, s *storage.Storage)
+	}{
+		{"create", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "+7 900 000-00-01", "one@example.com"))
+			got, err := s.GetOrder(t.Context(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != models.OrderStatusNew || got.Delivery.Phone != "+7 900 000-00-01" ||
+				got.Payment.Transaction != "tx-order-1" || len(got.Items) != 1 {
+				t.Fatalf("read back %+v", got)
+			}
+			records, err := s.GetOrderAudit(t.Context(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"create order", "create delivery", "create payment", "create item"}
+			if !slices.Equal(actions(records), want) {
+				t.Fatalf("audit %v, want %v", actions(records), want)
+			}
+			if _, err := s.GetOrder(t.Context(), "missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("missing: got %v, want gorm.ErrRecordNotFound", err)
+			}
+		}},
+		{"duplicate", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "", ""))
+			_, err := s.CreateOrder(t.Context(), newTestOrder("order-1", "cust-2", "", ""))
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("got %v, want gorm.ErrDuplicatedKey", err)
+			}
+		}},
+		{"update with audit", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "", ""))
+			ctx := audit.WithActor(t.Context(), "apikey:test")
+			after, err := s.UpdateOrder(ctx, "order-1", func(o *models.Order) {
+				o.Delivery.City = "Kazan"
+				o.Items[0].Price = 950
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Delivery.City != "Kazan" || after.Items[0].Price != 950 {
+				t.Fatalf("updated %+v", after)
+			}
+			records, err := s.GetOrderAudit(t.Context(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			updates := records[len(records)-2:]
+			if got := actions(updates); !slices.Equal(got, []string{"update delivery", "update item"}) {
+				t.Fatalf("update audit %v", got)
+			}
+			for _, r := range updates {
+				if r.Actor != "apikey:test" {
+					t.Errorf("%s: actor %q", r.Entity, r.Actor)
+				}
+			}
+			if !strings.Contains(updates[0].Diff, "Kazan") || strings.Contains(updates[0].Diff, "Test Testov") {
+				t.Errorf("delivery diff %s, want only the changed city", updates[0].Diff)
+			}
+			if _, err := s.UpdateOrder(ctx, "missing", func(*models.Order) {}); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("missing: got %v, want gorm.ErrRecordNotFound", err)
+			}
+		}},
+		{"soft delete", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "", ""))
+			if _, err := s.DeleteOrder(t.Context(), "order-1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetOrder(t.Context(), "order-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("deleted order: got %v, want gorm.ErrRecordNotFound", err)
+			}
+			if _, err := s.DeleteOrder(t.Context(), "order-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("second delete: got %v, want gorm.ErrRecordNotFound", err)
+			}
+			// строки остаются с deleted_at - вместе с доставкой, платежом и товарами
+			for _, m := range []any{&models.Order{}, &models.Delivery{}, &models.Payment{}, &models.Item{}} {
+				var total, deleted int64
+				s.Db.Unscoped().Model(m).Count(&total)
+				s.Db.Unscoped().Model(m).Where("deleted_at IS NOT NULL").Count(&deleted)
+				if total != 1 || deleted != 1 {
+					t.Errorf("%T: %d rows, %d soft-deleted, want 1 and 1", m, total, deleted)
+				}
+			}
+			records, err := s.GetOrderAudit(t.Context(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"delete order", "delete delivery", "delete payment", "delete item"}
+			if got := actions(records[4:]); !slices.Equal(got, want) {
+				t.Fatalf("delete audit %v, want %v", got, want)
+			}
+		}},
+		{"as_of", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "", ""))
+			time.Sleep(20 * time.Millisecond)
+			created := time.Now()
+			time.Sleep(20 * time.Millisecond)
+			if _, err := s.UpdateOrder(t.Context(), "order-1", func(o *models.Order) { o.Delivery.City = "Kazan" }); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			updated := time.Now()
+			time.Sleep(20 * time.Millisecond)
+			if _, err := s.DeleteOrder(t.Context(), "order-1"); err != nil {
+				t.Fatal(err)
+			}
+
+			for at, wantCity := range map[time.Time]string{created: "Moscow", updated: "Kazan", time.Now(): ""} {
+				records, err := s.GetOrderAuditUntil(t.Context(), "order-1", at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				order, err := audit.Reconstruct(records)
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch {
+				case wantCity == "" && order != nil:
+					t.Errorf("after delete: reconstructed %+v, want nil", order)
+				case wantCity != "" && (order == nil || order.Delivery.City != wantCity):
+					t.Errorf("as of %s: got %+v, want city %s", at.Format(time.RFC3339Nano), order, wantCity)
+				}
+			}
+			before, err := s.GetOrderAuditUntil(t.Context(), "order-1", created.Add(-time.Hour))
+			if err != nil || len(before) != 0 {
+				t.Fatalf("before creation: %d records, err %v", len(before), err)
+			}
+		}},
+		{"blind index filters", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "+7 (900) 123-45-67", "Ivan@Example.com"))
+			mustCreateOrder(t, s, newTestOrder("order-2", "cust-1", "+7 900 765 43 21", "petr@example.com"))
+			mustCreateOrder(t, s, newTestOrder("order-3", "cust-2", "79001234567", "other@example.com"))
+			for _, tc := range []struct {
+				filter models.OrderFilter
+				want   []string
+			}{
+				{models.OrderFilter{Phone: "79001234567"}, []string{"order-1", "order-3"}},
+				{models.OrderFilter{Phone: "+7-900-123-45-67", CustomerID: "cust-1"}, []string{"order-1"}},
+				{models.OrderFilter{Email: " IVAN@example.com "}, []string{"order-1"}},
+				{models.OrderFilter{Email: "nobody@example.com"}, nil},
+				{models.OrderFilter{CustomerID: "cust-1"}, []string{"order-1", "order-2"}},
+			} {
+				orders, err := s.ListOrders(t.Context(), tc.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, o := range orders {
+					got = append(got, o.OrderUID)
+				}
+				if !slices.Equal(got, tc.want) {
+					t.Errorf("filter %+v: got %v, want %v", tc.filter, got, tc.want)
+				}
+			}
+		}},
+		{"erase customer", func(t *testing.T, s *storage.Storage) {
+			mustCreateOrder(t, s, newTestOrder("order-1", "cust-1", "+79001234567", "ivan@example.com"))
+			mustCreateOrder(t, s, newTestOrder("order-2", "cust-1", "+79001234567", "ivan@example.com"))
+			mustCreateOrder(t, s, newTestOrder("order-3", "cust-2", "+79007654321", "petr@example.com"))
+			if _, err := s.DeleteOrder(t.Context(), "order-2"); err != nil {
+				t.Fatal(err)
+			}
+			// сохранённые ответы POST /order: ответ с заказом клиента удаляется, с чужим - остаётся
+			responses := map[string]string{
+				"key-1": `{"order_uid":"order-1","delivery":{"email":"ivan@example.com"}}`,
+				"key-3": `{"order_uid":"order-3","delivery":{"email":"petr@example.com"}}`,
+				"key-4": `{"order_uid":"order-10"}`,
+			}
+			for key, body := range responses {
+				if _, err := s.ReserveIdempotencyKey(t.Context(), key, "fp", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.CompleteIdempotencyKey(t.Context(), key, http.StatusCreated, "application/json", []byte(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			uids, err := s.EraseCustomer(t.Context(), "cust-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(uids, []string{"order-1", "order-2"}) {
+				t.Fatalf("erased %v, want order-1 and the deleted order-2", uids)
+			}
+			orders, err := s.GetCustomerOrders(t.Context(), "cust-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range orders {
+				d := o.Delivery
+				if d.Name != models.ErasedName || d.Phone != "" || d.Email != "" || d.Address != "" || d.PhoneHash != "" {
+					t.Errorf("%s: delivery %+v is not anonymised", o.OrderUID, d)
+				}
+				if o.Payment.Amount != 1000 || len(o.Items) != 1 {
+					t.Errorf("%s: payment or items changed", o.OrderUID)
+				}
+			}
+			if found, _ := s.ListOrders(t.Context(), models.OrderFilter{Phone: "+79001234567"}); len(found) != 0 {
+				t.Errorf("erased phone still finds %d orders", len(found))
+			}
+			records, err := s.GetOrderAudit(t.Context(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range records {
+				if strings.Contains(r.Before+r.After+r.Diff, "ivan@example.com") {
+					t.Errorf("%s %s audit record still has the email", r.Action, r.Entity)
+				}
+			}
+			if last := records[len(records)-1]; last.Action != models.AuditActionErase {
+				t.Errorf("last audit record is %s, want erase", last.Action)
+			}
+			other, err := s.GetOrder(t.Context(), "order-3")
+			if err != nil || other.Delivery.Email != "petr@example.com" {
+				t.Fatalf("other customer touched: %+v, %v", other, err)
+			}
+			var kept []string
+			if err := s.Db.Model(&models.IdempotencyKey{}).Order("idempotency_key").Pluck("idempotency_key", &kept).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(kept, []string{"key-3", "key-4"}) {
+				t.Errorf("idempotency keys after erase %v, want key-3 and key-4", kept)
+			}
+			if _, err := s.EraseCustomer(t.Context(), "nobody"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("unknown customer: got %v, want gorm.ErrRecordNotFound", err)
+			}
+		}},
+		{"create orders batch", func(t *testing.T, s *storage.Storage) {
+			batch := []*models.Order{newTestOrder("order-1", "cust-1", "", ""), newTestOrder("order-2", "cust-1", "", "")}
+			if err := s.CreateOrdersBatch(t.Context(), batch); err != nil {
+				t.Fatal(err)
+			}
+			for _, uid := range []string{"order-1", "order-2"} {
+				order, err := s.GetOrder(t.Context(), uid)
+				if err != nil || len(order.Items) != 1 {
+					t.Fatalf("%s: %+v, %v", uid, order, err)
+				}
+				if records, _ := s.GetOrderAudit(t.Context(), uid); len(records) != 4 {
+					t.Errorf("%s: %d audit records, want 4", uid, len(records))
+				}
+			}
+			// пачка с уже существующим заказом не записывается целиком
+			err := s.CreateOrdersBatch(t.Context(), []*models.Order{newTestOrder("order-3", "cust-1", "", ""), newTestOrder("order-1", "cust-1", "", "")})
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("got %v, want gorm.ErrDuplicatedKey", err)
+			}
+			if _, err := s.GetOrder(t.Context(), "order-3"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("order-3 from the failed batch: got %v, want gorm.ErrRecordNotFound", err)
+			}
+			if records, _ := s.GetOrderAudit(t.Context(), "order-3"); len(records) != 0 {
+				t.Errorf("failed batch left %d audit records", len(records))
+			}
+			if err := s.CreateOrdersBatch(t.Context(), nil); err != nil {
+				t.Fatalf("empty batch: %v", err)
+			}
+		}},
+	}
+
+	for _, b := range storagetest.Backends(t, storagetest.InMemory) {
+		t.Run(b.Name, func(t *testing.T) {
+			for _, tc := range cases {
+				t.Run(tc.name, func(t *testing.T) {
+					tc.run(t, b.Open(t))
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+
+	"WB2/internal/audit"
+	"WB2/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetCustomerOrders возвращает все заказы клиента, включая удалённые, со связанными сущностями
+func (s *Storage) GetCustomerOrders(ctx context.Context, customerID string) ([]models.Order, error) {
+	var orders []models.Order
+	err := s.Db.WithContext(ctx).Unscoped().Preload("Delivery").Preload("Payment").Preload("Items").
+		Where("customer_id = ?", customerID).Order("id").Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// EraseCustomer обезличивает данные получателя во всех заказах клиента (включая удалённые) и возвращает их UID.
+// Суммы платежей и товары не меняются. Персональные данные вычищаются и из прошлых записей журнала доставки,
+// а само обезличивание фиксируется записью с действием erase. В той же транзакции удаляются сохранённые
+// ответы идемпотентных запросов с этими заказами. Если заказов нет - gorm.ErrRecordNotFound
+func (s *Storage) EraseCustomer(ctx context.Context, customerID string) ([]string, error) {
+	var uids []string
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []models.Order
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", customerID).Order("id").Find(&orders).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		erased := audit.ErasedDeliveryFields()
+		actor := audit.ActorFromContext(ctx)
+		for _, o := range orders {
+			var order models.Order
+			if err := tx.Unscoped().Preload("Delivery").Preload("Payment").Preload("Items").First(&order, o.ID).Error; err != nil {
+				return err
+			}
+			uids = append(uids, order.OrderUID)
+
+			// Сначала вычищаем историю, затем добавляем запись об обезличивании
+			var history []models.OrderAudit
+			if err := tx.Where("order_uid = ? AND entity = ?", order.OrderUID, models.AuditEntityDelivery).Find(&history).Error; err != nil {
+				return err
+			}
+			for i := range history {
+				if err := audit.Scrub(&history[i], erased); err != nil {
+					return err
+				}
+				if err := tx.Model(&history[i]).Select("before", "after", "diff").Updates(&history[i]).Error; err != nil {
+					return err
+				}
+			}
+
+			if order.Delivery.ID == 0 {
+				continue
+			}
+			before := order
+			before.Items = slices.Clone(order.Items)
+			order.Delivery.Anonymize()
+			if err := tx.Unscoped().Model(&order.Delivery).Select("name", "phone", "email", "address", "zip", "phone_hash", "email_hash").
+				Updates(&order.Delivery).Error; err != nil {
+				return err
+			}
+
+			records, err := audit.Changes(actor, &before, &order)
+			if err != nil {
+				return err
+			}
+			// Запись фиксирует, какие поля обезличены, но не их прежние значения
+			for i := range records {
+				records[i].Action = models.AuditActionErase
+				if err := audit.Scrub(&records[i], erased); err != nil {
+					return err
+				}
+			}
+			if len(records) > 0 {
+				if err := tx.Create(&records).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return eraseIdempotentResponses(tx, uids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// eraseIdempotentResponses удаляет сохранённые ответы идемпотентных запросов, в которых упомянут один из заказов uids:
+// ответ POST /order содержит данные доставки. Тело ответа зашифровано, поэтому искать по нему в БД нельзя -
+// ответы расшифровываются и проверяются пачками
+func eraseIdempotentResponses(tx *gorm.DB, uids []string) error {
+	quoted := make([][]byte, 0, len(uids))
+	for _, uid := range uids {
+		// order_uid в JSON-ответе - строка в кавычках, так UID не совпадёт с началом другого
+		q, err := json.Marshal(uid)
+		if err != nil {
+			return err
+		}
+		quoted = append(quoted, q)
+	}
+	var keys []string
+	var batch []models.IdempotencyKey
+	err := tx.Where("status_code <> 0").FindInBatches(&batch, 100, func(*gorm.DB, int) error {
+		for _, k := range batch {
+			if slices.ContainsFunc(quoted, func(q []byte) bool { return bytes.Contains(k.Body, q) }) {
+				keys = append(keys, k.Key)
+			}
+		}
+		return nil
+	}).Error
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return tx.Where("idempotency_key IN ?", keys).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"WB2/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// GetOrderEvent возвращает запись об обработанном событии; gorm.ErrRecordNotFound, если событие не встречалось
+func (s *Storage) GetOrderEvent(ctx context.Context, eventID string) (*models.OrderEvent, error) {
+	var e models.OrderEvent
+	if err := s.Db.WithContext(ctx).Where("event_id = ?", eventID).First(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// LastOrderEventAt возвращает occurred_at самого нового применённого события этого вида
+// (заказ, тип, объект) или нулевое время, если таких не было
+func (s *Storage) LastOrderEventAt(ctx context.Context, orderUID, eventType, subject string) (time.Time, error) {
+	var e models.OrderEvent
+	err := s.Db.WithContext(ctx).
+		Where("order_uid = ? AND type = ? AND subject = ? AND outcome = ?", orderUID, eventType, subject, models.EventApplied).
+		Order("occurred_at DESC").Limit(1).Find(&e).Error
+	return e.OccurredAt, err
+}
+
+// SaveOrderEvent записывает обработанное событие; повторная запись того же события игнорируется
+func (s *Storage) SaveOrderEvent(ctx context.Context, e *models.OrderEvent) error {
+	return s.Db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(e).Error
+}
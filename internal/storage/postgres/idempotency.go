@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"WB2/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReserveIdempotencyKey пытается занять ключ под новый запрос.
+// Если ключ свободен (или истёк), создаётся запись "в обработке" и возвращается (nil, nil);
+// иначе возвращается уже существующая запись
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Истёкший ключ освобождаем, чтобы его можно было занять заново
+		if err := tx.Where("idempotency_key = ? AND expires_at < ?", key, now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		rec := models.IdempotencyKey{
+			Key:         key,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return nil
+		}
+		var found models.IdempotencyKey
+		if err := tx.Where("idempotency_key = ?", key).First(&found).Error; err != nil {
+			return err
+		}
+		existing = &found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ, который будет повторно отдан на повторные запросы с тем же ключом
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return s.Db.WithContext(ctx).Model(&models.IdempotencyKey{}).Where("idempotency_key = ?", key).
+		Select("status_code", "content_type", "body").
+		// структура, а не map: иначе тело не пройдёт через сериализатор шифрования
+		Updates(&models.IdempotencyKey{StatusCode: statusCode, ContentType: contentType, Body: body}).Error
+}
+
+// ReleaseIdempotencyKey удаляет ключ, если запрос не удалось обработать, чтобы клиент мог повторить его
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return s.Db.WithContext(ctx).Where("idempotency_key = ?", key).Delete(&models.IdempotencyKey{}).Error
+}
+
+// StartIdempotencyCleaner запускает фоновое удаление истёкших ключей идемпотентности
+func (s *Storage) StartIdempotencyCleaner(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+			}
+		}
+	}()
+}
@@ -1,52 +1,122 @@
 package storage
 
 import (
+	"WB2/internal/audit"
+	"WB2/internal/config"
+	"WB2/internal/encryption"
 	"WB2/internal/models"
+	"context"
+	"database/sql"
 	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 type Storage struct {
 	Db *gorm.DB
+	// Driver - диалект БД: DriverPostgres или DriverSQLite
+	Driver string
 }
 
-// NewStorage открывает соединение с PostgreSQL и применяет миграции
-func NewStorage(storagePath string) (*Storage, error) {
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Open открывает хранилище, выбранное в storage.driver
+func Open(cfg *config.Config) (*Storage, error) {
+	switch cfg.Storage.Driver {
+	case DriverPostgres:
+		return NewStorage(cfg.Database.DB_CONNECTION_STRING, cfg.Env)
+	case DriverSQLite:
+		return NewSQLiteStorage(cfg.Storage.SQLitePath, cfg.Env)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q (want %s or %s)", cfg.Storage.Driver, DriverPostgres, DriverSQLite)
+}
+
+// NewStorage открывает соединение с PostgreSQL и применяет миграции.
+// В prod SQL логируется без значений параметров: в них персональные данные заказов
+func NewStorage(storagePath, env string) (*Storage, error) {
 	const op = "storage.postgres.NewStorage"
 
-	newLogger := logger.Default.LogMode(logger.Info)
+	db, err := openGorm(postgres.Open(storagePath), env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Storage{Db: db, Driver: DriverPostgres}, nil
+}
 
-	db, err := gorm.Open(postgres.Open(storagePath), &gorm.Config{
-		Logger: newLogger,
+// openGorm открывает БД через dialector и применяет миграции
+func openGorm(dialector gorm.Dialector, env string) (*gorm.DB, error) {
+	newLogger := logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:        200 * time.Millisecond,
+		LogLevel:             logger.Info,
+		Colorful:             env != "prod",
+		ParameterizedQueries: env == "prod",
 	})
 
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: newLogger,
+		// Нарушение уникальности возвращается как gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
 	// Важно: сначала создаем orders, затем сущности с FK на неё
-	if err := db.AutoMigrate(&models.Order{}, &models.Delivery{}, &models.Payment{}, &models.Item{}); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	if err := db.AutoMigrate(&models.Order{}, &models.Delivery{}, &models.Payment{}, &models.Item{}, &models.IdempotencyKey{}, &models.OrderStatusHistory{}, &models.OrderAudit{}, &models.RateLimitBucket{}, &models.OrderEvent{}); err != nil {
+		return nil, err
 	}
 
 	// Добавим уникальный индекс на order_uid для идемпотентности
 	_ = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_order_uid ON orders (order_uid)")
 
-	return &Storage{Db: db}, nil
+	if err := backfillBlindIndexes(db); err != nil {
+		return nil, fmt.Errorf("blind index backfill: %w", err)
+	}
+	if err := backfillAuditBaseline(db); err != nil {
+		return nil, fmt.Errorf("audit baseline: %w", err)
+	}
+
+	return db, nil
+}
+
+// Ping проверяет соединение с БД и возвращает статистику пула
+func (s *Storage) Ping(ctx context.Context) (sql.DBStats, error) {
+	sqlDB, err := s.Db.DB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	return sqlDB.Stats(), sqlDB.PingContext(ctx)
+}
+
+// Close закрывает пул соединений с БД
+func (s *Storage) Close() error {
+	sqlDB, err := s.Db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
-// CreateOrder создает новый заказ со всеми связанными данными и возвращает UID
-func (s *Storage) CreateOrder(order *models.Order) (string, error) {
+// CreateOrder создает новый заказ со всеми связанными данными и возвращает UID.
+// В той же транзакции пишется журнал изменений с автором из контекста
+func (s *Storage) CreateOrder(ctx context.Context, order *models.Order) (string, error) {
 	// Транзакция для сохранения агрегата
-	err := s.Db.Transaction(func(tx *gorm.DB) error {
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(order).Error; err != nil {
 			return err
 		}
 		// ассоциации создаются через Create(order) с gorm, но транзакция гарантирует атомарность
-		return nil
+		return writeAudit(tx, audit.ActorFromContext(ctx), nil, order)
 	})
 	if err != nil {
 		return "", err
@@ -63,21 +133,170 @@ func (s *Storage) GetAllOrders() ([]models.Order, error) {
 	return orders, nil
 }
 
-// GetOrderByUID получает заказ по order_uid
-func (s *Storage) GetOrderByUID(orderUID string) (*models.Order, error) {
+// GetOrder получает заказ по order_uid вместе с доставкой, платежом и товарами
+func (s *Storage) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
 	var order models.Order
-	if err := s.Db.Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
+	if err := s.Db.WithContext(ctx).Preload("Delivery").Preload("Payment").Preload("Items").Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
 		return nil, err
 	}
 	return &order, nil
 }
 
-// UpdateOrder обновляет заказ
-func (s *Storage) UpdateOrder(order *models.Order) (string, error) {
-	return order.OrderUID, s.Db.Save(order).Error
+// UpdateOrder загружает заказ, применяет к нему apply и сохраняет заказ и связанные сущности в одной транзакции.
+// Возвращает состояние заказа после сохранения; изменения пишутся в журнал
+func (s *Storage) UpdateOrder(ctx context.Context, orderUID string, apply func(order *models.Order)) (*models.Order, error) {
+	var after models.Order
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Delivery").Preload("Payment").Preload("Items").First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		before := order
+		before.Items = slices.Clone(order.Items)
+
+		apply(&order)
+
+		// Сохраняем основные поля заказа
+		if err := tx.Save(&order).Error; err != nil {
+			return err
+		}
+		// Сохраняем связанные сущности
+		if err := tx.Save(&order.Delivery).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(&order.Payment).Error; err != nil {
+			return err
+		}
+		for i := range order.Items {
+			order.Items[i].OrderID = order.ID
+			if err := tx.Save(&order.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Preload("Delivery").Preload("Payment").Preload("Items").First(&after, order.ID).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, audit.ActorFromContext(ctx), &before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+// DeleteOrder мягко удаляет заказ по OrderUID вместе с доставкой, платежом и товарами; удаление фиксируется
+// в журнале со снимками всех этих сущностей
+func (s *Storage) DeleteOrder(ctx context.Context, orderUID string) (string, error) {
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Preload("Delivery").Preload("Payment").Preload("Items").Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
+			return err
+		}
+		// Связанные строки удаляются так же, как заказ, чтобы журнал совпадал с содержимым БД
+		for _, child := range []any{&models.Delivery{}, &models.Payment{}, &models.Item{}} {
+			if err := tx.Where("order_id = ?", order.ID).Delete(child).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&order).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, audit.ActorFromContext(ctx), &order, nil)
+	})
+	return orderUID, err
 }
 
-// DeleteOrder удаляет заказ по OrderUID
-func (s *Storage) DeleteOrder(orderUID string) (string, error) {
-	return orderUID, s.Db.Where("order_uid = ?", orderUID).Delete(&models.Order{}).Error
+// applyOrderFilter добавляет к запросу условия фильтра заказов
+func applyOrderFilter(q *gorm.DB, f models.OrderFilter) *gorm.DB {
+	if f.CustomerID != "" {
+		q = q.Where("customer_id = ?", f.CustomerID)
+	}
+	if f.TrackNumber != "" {
+		q = q.Where("track_number = ?", f.TrackNumber)
+	}
+	if f.DeliveryService != "" {
+		q = q.Where("delivery_service = ?", f.DeliveryService)
+	}
+	if f.CreatedFrom != nil {
+		q = q.Where("date_created >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		q = q.Where("date_created < ?", *f.CreatedTo)
+	}
+	// Телефон и почта зашифрованы - сравниваем blind index нормализованного значения
+	if f.Phone != "" {
+		q = q.Where("id IN (?)", q.Session(&gorm.Session{NewDB: true}).Model(&models.Delivery{}).
+			Select("order_id").Where("phone_hash = ?", encryption.BlindIndex(encryption.NormalizePhone(f.Phone))))
+	}
+	if f.Email != "" {
+		q = q.Where("id IN (?)", q.Session(&gorm.Session{NewDB: true}).Model(&models.Delivery{}).
+			Select("order_id").Where("email_hash = ?", encryption.BlindIndex(encryption.NormalizeEmail(f.Email))))
+	}
+	return q
+}
+
+// ListOrders получает заказы, подходящие под фильтр
+func (s *Storage) ListOrders(ctx context.Context, f models.OrderFilter) ([]models.Order, error) {
+	var orders []models.Order
+	q := applyOrderFilter(s.Db.WithContext(ctx).Model(&models.Order{}), f)
+	if err := q.Preload("Delivery").Preload("Payment").Preload("Items").Order("id").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// StreamOrders читает заказы под фильтр порциями по batchSize (keyset по первичному ключу),
+// чтобы потребление памяти не зависело от объёма выборки
+func (s *Storage) StreamOrders(ctx context.Context, f models.OrderFilter, batchSize int, fn func([]models.Order) error) error {
+	var batch []models.Order
+	q := applyOrderFilter(s.Db.WithContext(ctx).Model(&models.Order{}), f)
+	return q.Preload("Delivery").Preload("Payment").Preload("Items").
+		FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(batch)
+		}).Error
+}
+
+// insertBatchSize - число строк в одном INSERT при пакетной вставке (держим число параметров запроса в пределах лимита PostgreSQL)
+const insertBatchSize = 100
+
+// ExistingOrderUIDs возвращает множество order_uid из списка, уже сохранённых в БД
+func (s *Storage) ExistingOrderUIDs(ctx context.Context, uids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(uids) == 0 {
+		return existing, nil
+	}
+	var found []string
+	if err := s.Db.WithContext(ctx).Model(&models.Order{}).Where("order_uid IN ?", uids).Pluck("order_uid", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, uid := range found {
+		existing[uid] = true
+	}
+	return existing, nil
+}
+
+// CreateOrdersBatch сохраняет пачку заказов со связанными сущностями в одной транзакции
+func (s *Storage) CreateOrdersBatch(ctx context.Context, orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	actor := audit.ActorFromContext(ctx)
+	return s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(orders, insertBatchSize).Error; err != nil {
+			return err
+		}
+		for _, order := range orders {
+			if err := writeAudit(tx, actor, nil, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"WB2/internal/config"
+	"WB2/internal/models"
+	"WB2/internal/ratelimit"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TakeRateLimitToken забирает токен из общей корзины key. Строка корзины блокируется на время транзакции,
+// поэтому параллельные запросы с разных реплик расходуют токены последовательно
+func (s *Storage) TakeRateLimitToken(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error) {
+	var (
+		allowed bool
+		wait    time.Duration
+	)
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var b models.RateLimitBucket
+		err := lockRateLimitBucket(tx, key, &b)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// первый запрос клиента: заводим полную корзину. Если параллельная реплика успела раньше,
+			// вставка пропускается, и обе реплики расходуют токены из одной строки под блокировкой
+			full := models.RateLimitBucket{Key: key, Tokens: float64(limit.Burst), UpdatedAt: now, IdleAfter: now}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&full).Error; err != nil {
+				return err
+			}
+			err = lockRateLimitBucket(tx, key, &b)
+		}
+		if err != nil {
+			return err
+		}
+		b.Tokens, allowed, wait = ratelimit.Refill(b.Tokens, b.UpdatedAt, now, limit)
+		return tx.Model(&models.RateLimitBucket{}).Where("bucket_key = ?", key).Updates(map[string]any{
+			"tokens":     b.Tokens,
+			"updated_at": now,
+			"idle_after": ratelimit.IdleAfter(now, limit),
+		}).Error
+	})
+	return allowed, wait, err
+}
+
+func lockRateLimitBucket(tx *gorm.DB, key string, b *models.RateLimitBucket) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).First(b).Error
+}
+
+// DeleteIdleRateLimitBuckets удаляет корзины, которые к моменту now гарантированно полны:
+// следующий запрос клиента заведёт такую же полную корзину заново. У корзин, заведённых до появления
+// idle_after, он пуст: они удаляются после часа без запросов
+func (s *Storage) DeleteIdleRateLimitBuckets(ctx context.Context, now time.Time) (int64, error) {
+	res := s.Db.WithContext(ctx).Where("idle_after < ? OR (idle_after IS NULL AND updated_at < ?)", now, now.Add(-time.Hour)).
+		Delete(&models.RateLimitBucket{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"WB2/internal/config"
+	"WB2/internal/models"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	s, err := NewSQLiteStorage(t.TempDir()+"/ratelimit.db", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	limit := config.Limit{RPS: 0.001, Burst: 3}
+
+	// параллельные первые запросы не должны перезаписывать корзину друг друга
+	var (
+		mu      sync.Mutex
+		allowed int
+		wg      sync.WaitGroup
+	)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := s.TakeRateLimitToken(t.Context(), "client", limit)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != limit.Burst {
+		t.Fatalf("allowed %d of 5 requests, want burst %d", allowed, limit.Burst)
+	}
+	ok, wait, err := s.TakeRateLimitToken(t.Context(), "client", limit)
+	if err != nil || ok || wait <= 0 {
+		t.Fatalf("empty bucket: allowed %v, wait %v, err %v", ok, wait, err)
+	}
+
+	if _, _, err := s.TakeRateLimitToken(t.Context(), "fast", config.Limit{RPS: 1000, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := s.DeleteIdleRateLimitBuckets(t.Context(), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d buckets, want only the refilled one", deleted)
+	}
+	var left []models.RateLimitBucket
+	if err := s.Db.Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].Key != "client" {
+		t.Fatalf("left buckets %+v, want client", left)
+	}
+}
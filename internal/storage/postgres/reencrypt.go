@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"WB2/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ReencryptStats - число переписанных строк по таблицам
+type ReencryptStats map[string]int
+
+// Reencrypt перечитывает все строки с зашифрованными колонками и записывает их заново: значения расшифровываются
+// любым ключом из набора и шифруются активным, открытые значения (до включения шифрования) шифруются впервые.
+// Заодно пересчитываются blind index. Операция идемпотентна, её можно прервать и запустить повторно
+func (s *Storage) Reencrypt(ctx context.Context, batchSize int) (ReencryptStats, error) {
+	const op = "storage.postgres.Reencrypt"
+
+	db := s.Db.WithContext(ctx)
+	stats := make(ReencryptStats)
+	var err error
+	if stats["deliveries"], err = rewriteTable(db, batchSize, "", []string{"phone", "email", "address", "phone_hash", "email_hash"},
+		func(d *models.Delivery) { d.SetBlindIndexes() }); err != nil {
+		return stats, fmt.Errorf("%s: deliveries: %w", op, err)
+	}
+	if stats["payments"], err = rewriteTable(db, batchSize, "", []string{"transaction", "bank", "transaction_hash"},
+		func(p *models.Payment) { p.SetBlindIndexes() }); err != nil {
+		return stats, fmt.Errorf("%s: payments: %w", op, err)
+	}
+	if stats["order_audit"], err = rewriteTable(db, batchSize, "", []string{"before", "after", "diff"},
+		func(*models.OrderAudit) {}); err != nil {
+		return stats, fmt.Errorf("%s: order_audit: %w", op, err)
+	}
+	if stats["idempotency_keys"], err = rewriteTable(db, batchSize, "", []string{"body"},
+		func(*models.IdempotencyKey) {}); err != nil {
+		return stats, fmt.Errorf("%s: idempotency_keys: %w", op, err)
+	}
+	return stats, nil
+}
+
+// backfillBlindIndexes считает blind index для строк, записанных до их появления: без хеша такие платежи
+// не находятся проверкой дублей транзакций, а доставки - поиском по телефону и почте. Выполняется при каждой
+// миграции и трогает только строки с пустым хешем при непустом значении, поэтому отдельный запуск reencrypt
+// для этого не нужен
+func backfillBlindIndexes(db *gorm.DB) error {
+	const batchSize = 500
+	if _, err := rewriteTable(db, batchSize, `(transaction_hash IS NULL OR transaction_hash = '') AND "transaction" <> ''`,
+		[]string{"transaction_hash"}, func(p *models.Payment) { p.SetBlindIndexes() }); err != nil {
+		return fmt.Errorf("payments: %w", err)
+	}
+	if _, err := rewriteTable(db, batchSize, `((phone_hash IS NULL OR phone_hash = '') AND phone <> '') OR ((email_hash IS NULL OR email_hash = '') AND email <> '')`,
+		[]string{"phone_hash", "email_hash"}, func(d *models.Delivery) { d.SetBlindIndexes() }); err != nil {
+		return fmt.Errorf("deliveries: %w", err)
+	}
+	return nil
+}
+
+// rewriteTable переписывает columns в строках модели T (включая мягко удалённые), подходящих под where
+// (пусто - во всех), пачками по batchSize
+func rewriteTable[T any](db *gorm.DB, batchSize int, where string, columns []string, prepare func(*T)) (int, error) {
+	total := 0
+	var rows []T
+	q := db.Unscoped()
+	if where != "" {
+		q = q.Where(where)
+	}
+	err := q.FindInBatches(&rows, batchSize, func(batch *gorm.DB, _ int) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range rows {
+				prepare(&rows[i])
+				// UpdateColumns не трогает updated_at и хуки: меняется только представление данных, не сами данные
+				if err := tx.Unscoped().Model(&rows[i]).Select(columns).UpdateColumns(&rows[i]).Error; err != nil {
+					return err
+				}
+			}
+			total += len(rows)
+			return nil
+		})
+	}).Error
+	return total, err
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"testing"
+
+	"WB2/internal/encryption"
+	"WB2/internal/models"
+)
+
+// paymentsByTransaction - сколько платежей находит поиск по blind index идентификатора платежа
+func paymentsByTransaction(t *testing.T, s *Storage, transaction string) int64 {
+	t.Helper()
+	var n int64
+	if err := s.Db.Model(&models.Payment{}).Where("transaction_hash = ?", encryption.BlindIndex(transaction)).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMigrationBackfillsBlindIndexes(t *testing.T) {
+	path := t.TempDir() + "/orders.db"
+	s, err := NewSQLiteStorage(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{OrderUID: "legacy", Delivery: models.Delivery{Phone: "+7 (900) 123-45-67", Email: "Ivan@Example.com"},
+		Payment: models.Payment{Transaction: "tx-legacy"}}
+	if _, err := s.CreateOrder(t.Context(), &order); err != nil {
+		t.Fatal(err)
+	}
+	// строки, записанные до появления blind index
+	if err := s.Db.Exec("UPDATE payments SET transaction_hash = NULL").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Db.Exec("UPDATE deliveries SET phone_hash = '', email_hash = NULL").Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := paymentsByTransaction(t, s, "tx-legacy"); n != 0 {
+		t.Fatalf("before backfill: found %d payments by transaction", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSQLiteStorage(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	if n := paymentsByTransaction(t, s, "tx-legacy"); n != 1 {
+		t.Fatalf("after backfill: found %d payments by transaction, want 1", n)
+	}
+	for _, f := range []models.OrderFilter{{Phone: "79001234567"}, {Email: "ivan@example.com"}} {
+		orders, err := s.ListOrders(t.Context(), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orders) != 1 {
+			t.Errorf("filter %+v found %d orders, want 1", f, len(orders))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+)
+
+// NewSQLiteStorage открывает встроенную SQLite (файл path или ":memory:") с той же схемой, что и PostgreSQL.
+// Предназначена для локальной разработки и демо без внешних зависимостей.
+// Блокировки строк (SELECT ... FOR UPDATE) в SQLite не поддерживаются и опускаются диалектом, поэтому
+// запись сериализуется единственным соединением с БД
+func NewSQLiteStorage(path, env string) (*Storage, error) {
+	const op = "storage.sqlite.NewSQLiteStorage"
+
+	db, err := openGorm(sqlite.Open(sqliteDSN(path)), env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// База в памяти существует, пока открыто соединение, а файловая не допускает параллельной записи
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxIdleTime(0)
+	sqlDB.SetConnMaxLifetime(0)
+	return &Storage{Db: db, Driver: DriverSQLite}, nil
+}
+
+// sqliteDSN добавляет к пути включение внешних ключей и ожидание блокировок
+func sqliteDSN(path string) string {
+	if path == "" || path == ":memory:" {
+		path = "file::memory:"
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
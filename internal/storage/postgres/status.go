@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"WB2/internal/audit"
+	"WB2/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TransitionOrderStatus переводит заказ в новый статус по таблице переходов и пишет запись в order_status_history.
+// Строка заказа блокируется на время транзакции, чтобы параллельные переходы не обошли проверку
+func (s *Storage) TransitionOrderStatus(ctx context.Context, orderUID string, to models.OrderStatus, reason string) (*models.Order, error) {
+	var order models.Order
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_uid = ?", orderUID).First(&order).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Delivery").Preload("Payment").Preload("Items").First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		before := order
+		from := order.Status
+		if !from.CanTransitionTo(to) {
+			return fmt.Errorf("%w: %s -> %s", models.ErrIllegalTransition, from, to)
+		}
+		if err := tx.Model(&order).Update("status", to).Error; err != nil {
+			return err
+		}
+		history := models.OrderStatusHistory{
+			OrderID:    order.ID,
+			OrderUID:   order.OrderUID,
+			FromStatus: from,
+			ToStatus:   to,
+			Reason:     reason,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Delivery").Preload("Payment").Preload("Items").First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, audit.ActorFromContext(ctx), &before, &order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderStatusHistory возвращает историю смены статусов заказа в хронологическом порядке
+func (s *Storage) GetOrderStatusHistory(ctx context.Context, orderUID string) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+	if err := s.Db.WithContext(ctx).Where("order_uid = ?", orderUID).Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,96 @@
+// Package storagetest открывает хранилища заказов для тестов и бенчмарков: встроенную SQLite
+// и PostgreSQL во временной схеме, если задан TEST_POSTGRES_DSN
+package storagetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	storage "WB2/internal/storage/postgres"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// EnvPostgresDSN - строка подключения к PostgreSQL для прогона тестов на нём; каждое открытое хранилище
+// работает в своей временной схеме, которая удаляется после теста
+const EnvPostgresDSN = "TEST_POSTGRES_DSN"
+
+// Backend - хранилище, на котором прогоняется тест; Open открывает новое пустое хранилище
+type Backend struct {
+	Name string
+	Open func(tb testing.TB) *storage.Storage
+}
+
+// Backends - SQLite по пути из sqlitePath всегда, PostgreSQL - если задан EnvPostgresDSN
+func Backends(tb testing.TB, sqlitePath func(tb testing.TB) string) []Backend {
+	list := []Backend{{Name: storage.DriverSQLite, Open: func(tb testing.TB) *storage.Storage {
+		return OpenSQLite(tb, sqlitePath(tb))
+	}}}
+	if dsn := os.Getenv(EnvPostgresDSN); dsn != "" {
+		list = append(list, Backend{Name: storage.DriverPostgres, Open: func(tb testing.TB) *storage.Storage { return OpenPostgres(tb, dsn) }})
+	} else {
+		tb.Logf("%s is not set, postgres is skipped", EnvPostgresDSN)
+	}
+	return list
+}
+
+// InMemory - путь SQLite для Backends: база в памяти
+func InMemory(testing.TB) string {
+	return ":memory:"
+}
+
+// InFile - путь SQLite для Backends: файл во временном каталоге теста, запись идёт на диск
+func InFile(tb testing.TB) string {
+	return filepath.Join(tb.TempDir(), "orders.db")
+}
+
+// OpenSQLite открывает SQLite по пути path и закрывает её после теста
+func OpenSQLite(tb testing.TB, path string) *storage.Storage {
+	tb.Helper()
+	s, err := storage.NewSQLiteStorage(path, "test")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// OpenPostgres открывает PostgreSQL по dsn во временной схеме и удаляет её после теста
+func OpenPostgres(tb testing.TB, dsn string) *storage.Storage {
+	tb.Helper()
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schema := fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	// search_path передаётся серверу как параметр соединения в обоих форматах DSN
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	s, err := storage.NewStorage(dsn, "test")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = s.Close() })
+	return s
+}
@@ -0,0 +1,13 @@
+package tracing
+
+import (
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+
+	"gorm.io/gorm"
+)
+
+// InstrumentGORM добавляет спан на каждый запрос GORM. Значения параметров в спаны не попадают:
+// в них персональные данные. Родительский спан берётся из контекста запроса (db.WithContext)
+func InstrumentGORM(db *gorm.DB) error {
+	return db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables()))
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+)
+
+// producerHeaders - propagation.TextMapCarrier поверх заголовков исходящего сообщения
+type producerHeaders struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerHeaders) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c producerHeaders) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerHeaders) Keys() []string {
+	keys := make([]string, len(c.msg.Headers))
+	for i, h := range c.msg.Headers {
+		keys[i] = string(h.Key)
+	}
+	return keys
+}
+
+// consumerHeaders - propagation.TextMapCarrier поверх заголовков полученного сообщения (только чтение)
+type consumerHeaders struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c consumerHeaders) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c consumerHeaders) Set(string, string) {}
+
+func (c consumerHeaders) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// InjectKafka записывает контекст трассы ctx в заголовки сообщения (traceparent, tracestate, baggage)
+func InjectKafka(ctx context.Context, msg *sarama.ProducerMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, producerHeaders{msg})
+}
+
+// ExtractKafka возвращает ctx с контекстом трассы из заголовков сообщения
+func ExtractKafka(ctx context.Context, msg *sarama.ConsumerMessage) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, consumerHeaders{msg})
+}